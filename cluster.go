@@ -21,8 +21,6 @@ const (
 	Input = Size
 	// Scale is the scale of the search
 	Scale = 33 //48 96
-	// Width is the width of the result
-	Width = 150
 	// Samples is the number of samplee
 	Samples = Scale * (Scale - 1) / 2
 )
@@ -149,8 +147,37 @@ type Sample struct {
 	Ranks []float64
 }
 
+// Variances is the sum of squared deviations of the ranks of each row over every sample
+func Variances(samples []Sample, width int) []float64 {
+	sums := make([]float64, width)
+	for i := range samples {
+		for j := range samples[i].Ranks {
+			sums[j] += samples[i].Ranks[j]
+		}
+	}
+	averages := make([]float64, width)
+	for i := range sums {
+		averages[i] = sums[i] / float64(len(samples))
+	}
+	variances := make([]float64, width)
+	for i := range samples {
+		for j := range samples[i].Ranks {
+			diff := averages[j] - samples[i].Ranks[j]
+			variances[j] += diff * diff
+		}
+	}
+	return variances
+}
+
 // Process processes the samples' the probability distribution
-func Process(rng *rand.Rand, input Matrix, fisher []Fisher) []float64 {
+func Process(rng *rand.Rand, input Matrix, data *Dataset) ([]float64, error) {
+	if len(input.Data) != input.Cols*input.Rows {
+		return nil, fmt.Errorf("matrix is %dx%d but has %d values", input.Cols, input.Rows, len(input.Data))
+	}
+	if input.Rows != data.Rows() {
+		return nil, &ShapeError{What: "input", Row: -1, Got: input.Rows, Want: data.Rows()}
+	}
+	width := input.Rows
 	projections := make([]RandomMatrix, Scale)
 	for i := range projections {
 		seed := rng.Int63()
@@ -198,27 +225,11 @@ func Process(rng *rand.Rand, input Matrix, fisher []Fisher) []float64 {
 		<-done
 	}
 
-	sums := make([]float64, Width)
-	for i := range samples {
-		for j := range samples[i].Ranks {
-			sums[j] += samples[i].Ranks[j]
-		}
-	}
-	averages := make([]float64, Width)
-	for i := range sums {
-		averages[i] = sums[i] / float64(len(samples))
-	}
-	variances := make([]float64, Width)
-	for i := range averages {
-		for j := range samples[i].Ranks {
-			diff := averages[j] - samples[i].Ranks[j]
-			variances[j] += diff * diff
-		}
-	}
+	variances := Variances(samples, width)
 
-	/*for i, item := range fisher {
-		fmt.Println(item.Label, variances[i])
+	/*for i := range variances {
+		fmt.Println(data.Label(i), variances[i])
 	}*/
 
-	return variances
+	return variances, nil
 }
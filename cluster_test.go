@@ -0,0 +1,73 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestVariances(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		samples []Sample
+		want    []float64
+	}{
+		{"more rows than samples", []Sample{
+			{Ranks: []float64{1, 2, 3, 4, 5}},
+			{Ranks: []float64{3, 2, 1, 4, 5}},
+			{Ranks: []float64{2, 2, 2, 1, 5}},
+		}, []float64{2, 0, 2, 6, 0}},
+		// the samples after the first width still count
+		{"more samples than rows", []Sample{
+			{Ranks: []float64{1, 1}},
+			{Ranks: []float64{1, 1}},
+			{Ranks: []float64{1, 1}},
+			{Ranks: []float64{5, 1}},
+		}, []float64{12, 0}},
+	} {
+		variances := Variances(test.samples, len(test.want))
+		for i := range test.want {
+			if math.Abs(variances[i]-test.want[i]) > 1e-12 {
+				t.Errorf("%s: variances %v, want %v", test.name, variances, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestProcess(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	features := make([][]float64, 8)
+	for i := range features {
+		features[i] = []float64{rng.Float64(), rng.Float64(), rng.Float64()}
+	}
+	data := &Dataset{Features: features}
+	variances, err := Process(rand.New(rand.NewSource(1)), Flatten(features), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variances) != len(features) {
+		t.Fatalf("%d variances, want %d", len(variances), len(features))
+	}
+	for i, variance := range variances {
+		if variance < 0 || math.IsNaN(variance) {
+			t.Errorf("variance of row %d is %f", i, variance)
+		}
+	}
+
+	var shape *ShapeError
+	_, err = Process(rng, Flatten(features[:4]), data)
+	if !errors.As(err, &shape) || shape.Got != 4 || shape.Want != 8 {
+		t.Errorf("an input of 4 rows for 8 has error %v, want a shape error", err)
+	}
+	input := Flatten(features)
+	input.Data = input.Data[1:]
+	if _, err := Process(rng, input, data); err == nil {
+		t.Error("a short matrix has no error")
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package consensus implements consensus clustering
+package consensus
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/pointlander/ultra/kmeans"
+)
+
+// Missing is the label of a row that was left out of a resample
+const Missing = -1
+
+// ErrNoLabelings means there are no base labelings to combine
+var ErrNoLabelings = errors.New("no base labelings")
+
+// Clusterer is a base clustering algorithm
+type Clusterer func(seed int64, data [][]float64, k int) ([]int, error)
+
+// KmeansOptions is a k-means base clusterer with options such as the init method, the seed is set by each resample
+func KmeansOptions(distance kmeans.DistanceFunction, options kmeans.Options) Clusterer {
+	return func(seed int64, data [][]float64, k int) ([]int, error) {
+		options.Seed = seed
+		result, err := kmeans.Fit(data, k, distance, options)
+		return result.Labels, err
+	}
+}
+
+// Config configures consensus clustering
+type Config struct {
+	// Clusterer is the base clusterer, defaults to k-means with the distance and init, it isn't saved
+	Clusterer Clusterer `json:"-"`
+	// Distance is the registered name of the distance of the default k-means base clusterer, defaults to sqeuclidean
+	Distance string `json:"distance,omitempty"`
+	// Init is the name of the init method of the default k-means base clusterer, defaults to kmeans++
+	Init string `json:"init,omitempty"`
+	// Finisher partitions the co-association matrix, defaults to the finisher named by FinisherName, it isn't saved
+	Finisher Finisher `json:"-"`
+	// FinisherName is the registered name of the finisher used when Finisher is nil, defaults to kmeans
+	FinisherName string `json:"finisher,omitempty"`
+	// Combiner is the name of the ensemble combiner or Best, defaults to cspa
+	Combiner string `json:"combiner"`
+	// Resamples is the number of base clusterings, defaults to 100
+	Resamples int `json:"resamples"`
+	// Subsample is the fraction of rows in each resample, 0 means all
+	Subsample float64 `json:"subsample"`
+	// Features is the fraction of features in each resample, 0 means all
+	Features float64 `json:"features"`
+	// Seed is the seed of the first resample
+	Seed int64 `json:"seed"`
+	// Storage is how the co-association matrix is stored, defaults to packed
+	Storage string `json:"storage"`
+	// Threshold is the smallest co-association kept by sparse storage
+	Threshold float64 `json:"threshold"`
+}
+
+// Result is the result of consensus clustering
+type Result struct {
+	// Labels are the consensus labels
+	Labels []int
+	// CoAssociation is the fraction of resamples in which each pair was clustered together
+	CoAssociation Matrix
+	// Labelings are the base labelings, Missing for rows not in the resample
+	Labelings [][]int
+	// Seeds are the seeds of the base clusterings
+	Seeds []int64
+	// Combiner is the name of the combiner that made the labels
+	Combiner string
+	// ANMI is the average normalized mutual information with the base labelings of each combiner that was run
+	ANMI map[string]float64
+	// Config is the config with its defaults filled in
+	Config Config
+	// Summary summarizes the co-association matrix for the labels
+	Summary Summary
+}
+
+// sample picks round(fraction*n) of n indexes in order, at least min
+func sample(rng *rand.Rand, n int, fraction float64, min int) []int {
+	m := n
+	if fraction > 0 && fraction < 1 {
+		m = int(math.Round(fraction * float64(n)))
+	}
+	if m < min {
+		m = min
+	}
+	picked := make([]bool, n)
+	if m == n {
+		for i := range picked {
+			picked[i] = true
+		}
+	} else {
+		for _, i := range rng.Perm(n)[:m] {
+			picked[i] = true
+		}
+	}
+	indexes := make([]int, 0, m)
+	for i, ok := range picked {
+		if ok {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// Cluster clusters the data with k clusters by combining resampled base clusterings
+func Cluster(data [][]float64, k int, config Config) (*Result, error) {
+	if len(data) == 0 {
+		return nil, errors.New("no data")
+	}
+	if config.Clusterer == nil {
+		if config.Distance == "" {
+			config.Distance = "sqeuclidean"
+		}
+		distance, err := kmeans.Lookup(config.Distance)
+		if err != nil {
+			return nil, err
+		}
+		initialization, err := kmeans.ParseInit(config.Init)
+		if err != nil {
+			return nil, err
+		}
+		config.Init = initialization.String()
+		config.Clusterer = KmeansOptions(distance, kmeans.Options{Init: initialization, Workers: 1, Squared: kmeans.Squared(config.Distance)})
+	}
+	if config.Resamples <= 0 {
+		config.Resamples = 100
+	}
+	coassociation, err := NewAccumulator(len(data), config)
+	if err != nil {
+		return nil, err
+	}
+	rng := rand.New(rand.NewSource(config.Seed))
+	labelings := make([][]int, config.Resamples)
+	seeds := make([]int64, config.Resamples)
+	for r := range labelings {
+		rows := sample(rng, len(data), config.Subsample, k)
+		columns := sample(rng, len(data[0]), config.Features, 1)
+		input := make([][]float64, len(rows))
+		for i, row := range rows {
+			if len(columns) == len(data[row]) {
+				input[i] = data[row]
+				continue
+			}
+			input[i] = make([]float64, len(columns))
+			for j, column := range columns {
+				input[i][j] = data[row][column]
+			}
+		}
+		seeds[r] = config.Seed + int64(r)
+		labels, err := config.Clusterer(seeds[r], input, k)
+		if err != nil {
+			return nil, fmt.Errorf("resample %d: %w", r, err)
+		}
+		labeling := make([]int, len(data))
+		for i := range labeling {
+			labeling[i] = Missing
+		}
+		for i, row := range rows {
+			labeling[row] = labels[i]
+		}
+		labelings[r] = labeling
+		if err := coassociation.Add(labeling); err != nil {
+			return nil, err
+		}
+	}
+	result, err := finish(labelings, coassociation, k, config)
+	if err != nil {
+		return nil, err
+	}
+	result.Seeds = seeds
+	return result, nil
+}
+
+// NewAccumulator creates the co-association matrix selected by the storage of the config
+func NewAccumulator(n int, config Config) (Accumulator, error) {
+	switch config.Storage {
+	case StoragePacked, "":
+		return NewPacked(n), nil
+	case StorageSparse:
+		resamples := config.Resamples
+		if resamples <= 0 {
+			resamples = 100
+		}
+		return NewSparse(n, resamples, config.Threshold)
+	}
+	return nil, fmt.Errorf("unknown storage %q", config.Storage)
+}
+
+// CoAssociation computes the fraction of the labelings in which each pair of rows is clustered together
+func CoAssociation(labelings [][]int) (*Packed, error) {
+	coassociation := NewPacked(len(labelings[0]))
+	for _, labels := range labelings {
+		if err := coassociation.Add(labels); err != nil {
+			return nil, err
+		}
+	}
+	return coassociation, nil
+}
+
+// Combine combines base labelings into k consensus clusters with the finisher and seed of the config
+func Combine(labelings [][]int, k int, config Config) (*Result, error) {
+	if len(labelings) == 0 {
+		return nil, ErrNoLabelings
+	}
+	for _, labels := range labelings[1:] {
+		if len(labels) != len(labelings[0]) {
+			return nil, fmt.Errorf("labelings have lengths %d and %d", len(labelings[0]), len(labels))
+		}
+	}
+	config.Resamples = len(labelings)
+	coassociation, err := NewAccumulator(len(labelings[0]), config)
+	if err != nil {
+		return nil, err
+	}
+	for _, labels := range labelings {
+		if err := coassociation.Add(labels); err != nil {
+			return nil, err
+		}
+	}
+	return finish(labelings, coassociation, k, config)
+}
+
+// finish combines the labelings and their co-association matrix into k consensus clusters
+func finish(labelings [][]int, coassociation Matrix, k int, config Config) (*Result, error) {
+	if config.Combiner == "" {
+		config.Combiner = "cspa"
+	}
+	if config.Finisher == nil && config.FinisherName == "" {
+		config.FinisherName = "kmeans"
+	}
+	name, labels, anmi, err := combine(config.Combiner, labelings, coassociation, k, config)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		Labels:        labels,
+		CoAssociation: coassociation,
+		Labelings:     labelings,
+		Combiner:      name,
+		ANMI:          anmi,
+		Config:        config,
+		Summary:       Summarize(labels, coassociation),
+	}, nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consensus
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/pointlander/ultra/metrics"
+)
+
+const (
+	// HGPAImbalance is the allowed imbalance of the hypergraph partitions
+	HGPAImbalance = 0.05
+	// HGPAPasses is the maximum number of hypergraph refinement passes
+	HGPAPasses = 100
+	// HGPAStall is the number of moves without improvement that ends a refinement pass
+	HGPAStall = 100
+	// HGPACoarsest is the number of vertices per part below which the hypergraph isn't coarsened
+	HGPACoarsest = 10
+)
+
+// Combiner combines base labelings into k consensus labels
+type Combiner func(labelings [][]int, coassociation Matrix, k int, config Config) ([]int, error)
+
+// Combiners are the cluster ensemble combiners by name
+var Combiners = map[string]Combiner{
+	"cspa": CSPA,
+	"hgpa": HGPA,
+	"mcla": MCLA,
+}
+
+// Best is the name of the combiner that picks the combiner with the highest ANMI
+const Best = "best"
+
+// relabel maps labels to consecutive integers in order of appearance
+func relabel(labels []int) []int {
+	index := make(map[int]int)
+	for i, label := range labels {
+		value, ok := index[label]
+		if !ok {
+			value = len(index)
+			index[label] = value
+		}
+		labels[i] = value
+	}
+	return labels
+}
+
+// hyperedges converts labelings to hyperedges, one per cluster of each labeling
+func hyperedges(labelings [][]int) (edges [][]int, memberships [][]int) {
+	memberships = make([][]int, len(labelings[0]))
+	for _, labels := range labelings {
+		index := make(map[int]int)
+		for i, label := range labels {
+			if label == Missing {
+				continue
+			}
+			edge, ok := index[label]
+			if !ok {
+				edge = len(edges)
+				index[label] = edge
+				edges = append(edges, nil)
+			}
+			edges[edge] = append(edges[edge], i)
+			memberships[i] = append(memberships[i], edge)
+		}
+	}
+	return edges, memberships
+}
+
+// CSPA is the cluster-based similarity partitioning algorithm, it partitions the co-association matrix with the finisher
+func CSPA(labelings [][]int, coassociation Matrix, k int, config Config) ([]int, error) {
+	finisher, err := config.finisher()
+	if err != nil {
+		return nil, err
+	}
+	return finisher(config.Seed, coassociation, k)
+}
+
+// HGPA is the hypergraph partitioning algorithm, it finds k balanced parts that cut the fewest clusters
+func HGPA(labelings [][]int, coassociation Matrix, k int, config Config) ([]int, error) {
+	n := len(labelings[0])
+	if k < 1 || k > n {
+		return nil, fmt.Errorf("can't make %d clusters from %d rows", k, n)
+	}
+	edges, _ := hyperedges(labelings)
+	weights, costs := make([]int, n), make([]int, len(edges))
+	for i := range weights {
+		weights[i] = 1
+	}
+	for e := range costs {
+		costs[e] = 1
+	}
+	h := newHypergraph(weights, edges, costs)
+	return relabel(h.partition(rand.New(rand.NewSource(config.Seed)), k)), nil
+}
+
+// MCLA is the meta-clustering algorithm, it clusters the clusters and assigns each row to the meta-cluster it is most associated with
+func MCLA(labelings [][]int, coassociation Matrix, k int, config Config) ([]int, error) {
+	n := len(labelings[0])
+	edges, memberships := hyperedges(labelings)
+	if k < 1 || k > len(edges) {
+		return nil, fmt.Errorf("can't make %d meta-clusters from %d clusters", k, len(edges))
+	}
+	// jaccard only holds the pairs of clusters that share rows
+	jaccard := make(Adjacency, len(edges))
+	for a := range jaccard {
+		jaccard[a] = make(map[int]float64)
+	}
+	for row := 0; row < n; row++ {
+		for _, a := range memberships[row] {
+			for _, b := range memberships[row] {
+				if a != b {
+					jaccard[a][b]++
+				}
+			}
+		}
+	}
+	for a, row := range jaccard {
+		for b, shared := range row {
+			row[b] = shared / (float64(len(edges[a])+len(edges[b])) - shared)
+		}
+	}
+	finisher, err := config.finisher()
+	if err != nil {
+		return nil, err
+	}
+	meta, err := finisher(config.Seed, jaccard, k)
+	if err != nil {
+		return nil, err
+	}
+	sizes := make([]float64, k)
+	for _, m := range meta {
+		sizes[m]++
+	}
+	labels := make([]int, n)
+	for row := range labels {
+		association := make([]float64, k)
+		for _, e := range memberships[row] {
+			association[meta[e]] += 1 / sizes[meta[e]]
+		}
+		best := 0
+		for m := range association {
+			if association[m] > association[best] {
+				best = m
+			}
+		}
+		labels[row] = best
+	}
+	return relabel(labels), nil
+}
+
+// ANMI is the average normalized mutual information between the labels and the base labelings
+func ANMI(labels []int, labelings [][]int) (float64, error) {
+	sum := 0.0
+	for _, base := range labelings {
+		a, b := make([]int, 0, len(labels)), make([]int, 0, len(labels))
+		for i, label := range base {
+			if label != Missing {
+				a, b = append(a, label), append(b, labels[i])
+			}
+		}
+		scores, err := metrics.Compare(a, b)
+		if err != nil {
+			return 0, err
+		}
+		sum += scores.NMI
+	}
+	return sum / float64(len(labelings)), nil
+}
+
+// combine runs the named combiner, best runs every combiner and keeps the one with the highest ANMI
+func combine(name string, labelings [][]int, coassociation Matrix, k int, config Config) (string, []int, map[string]float64, error) {
+	names := []string{name}
+	if name == Best {
+		names = names[:0]
+		for name := range Combiners {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	var (
+		best   string
+		labels []int
+		scores = make(map[string]float64)
+	)
+	for _, name := range names {
+		combiner, ok := Combiners[name]
+		if !ok {
+			return "", nil, nil, fmt.Errorf("unknown combiner %q", name)
+		}
+		candidate, err := combiner(labelings, coassociation, k, config)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		anmi, err := ANMI(candidate, labelings)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		scores[name] = anmi
+		if labels == nil || anmi > scores[best] {
+			best, labels = name, candidate
+		}
+	}
+	return best, labels, scores, nil
+}
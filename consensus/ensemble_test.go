@@ -0,0 +1,80 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consensus
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/pointlander/ultra/metrics"
+)
+
+// truth shuffles k clusters of size rows
+func truth(rng *rand.Rand, k, size int) []int {
+	labels := make([]int, k*size)
+	for i, row := range rng.Perm(len(labels)) {
+		labels[row] = i % k
+	}
+	return labels
+}
+
+// relabeled copies the labels with their cluster names permuted
+func relabeled(rng *rand.Rand, labels []int, k int) []int {
+	names := rng.Perm(k)
+	copied := make([]int, len(labels))
+	for i, label := range labels {
+		copied[i] = names[label]
+	}
+	return copied
+}
+
+func TestHGPAIdentical(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, k := range []int{2, 3, 5} {
+		labels := truth(rng, k, 40)
+		labelings := make([][]int, 10)
+		for i := range labelings {
+			labelings[i] = relabeled(rng, labels, k)
+		}
+		consensus, err := HGPA(labelings, nil, k, Config{Seed: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		anmi, err := ANMI(consensus, labelings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if anmi != 1 {
+			t.Errorf("k=%d anmi %f, want 1", k, anmi)
+		}
+	}
+}
+
+// Base labelings that split a cluster in two still have the truth as their minimum cut
+func TestHGPASplit(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	labels := truth(rng, 3, 100)
+	labelings := make([][]int, 20)
+	for i := range labelings {
+		labelings[i] = relabeled(rng, labels, 3)
+		split := rng.Intn(3)
+		for row, label := range labelings[i] {
+			if label == split && rng.Intn(2) == 0 {
+				labelings[i][row] = 3
+			}
+		}
+	}
+	consensus, err := HGPA(labelings, nil, 3, Config{Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scores, err := metrics.Compare(labels, consensus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scores.ARI != 1 {
+		t.Errorf("ari with the truth %f, want 1", scores.ARI)
+	}
+}
@@ -0,0 +1,317 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consensus
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/pointlander/ultra/kmeans"
+)
+
+// Finisher partitions a co-association matrix into k clusters
+type Finisher func(seed int64, coassociation Matrix, k int) ([]int, error)
+
+// KmeansFinisher clusters the rows of the co-association matrix with k-means++, reading one row at a time
+func KmeansFinisher(seed int64, coassociation Matrix, k int) ([]int, error) {
+	n := coassociation.Len()
+	if k < 1 || k > n {
+		return nil, fmt.Errorf("can't make %d clusters from %d rows", k, n)
+	}
+	// row visits the co-association of row i with each row, the diagonal included
+	row := func(i int, f func(j int, value float64)) {
+		f(i, coassociation.At(i, i))
+		coassociation.Row(i, f)
+	}
+	norms := make([]float64, n)
+	for i := range norms {
+		row(i, func(j int, value float64) {
+			norms[i] += value * value
+		})
+	}
+	centroids, lengths := make([][]float64, k), make([]float64, k)
+	// distance is the squared euclidean distance from row i to centroid c
+	distance := func(i, c int) float64 {
+		dot := 0.0
+		row(i, func(j int, value float64) {
+			dot += value * centroids[c][j]
+		})
+		return math.Max(norms[i]+lengths[c]-2*dot, 0)
+	}
+	length := func(c int) {
+		lengths[c] = 0
+		for _, value := range centroids[c] {
+			lengths[c] += value * value
+		}
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	nearest := make([]float64, n)
+	for c := range centroids {
+		centroids[c] = make([]float64, n)
+		total := 0.0
+		for i := range nearest {
+			if c == 0 {
+				continue
+			}
+			if d := distance(i, c-1); c == 1 || d < nearest[i] {
+				nearest[i] = d
+			}
+			total += nearest[i]
+		}
+		// the next centroid is a row picked with probability proportional to its squared distance to the nearest centroid
+		pick := 0
+		if total == 0 {
+			pick = rng.Intn(n)
+		} else {
+			target := rng.Float64() * total
+			for ; pick < n-1; pick++ {
+				if target -= nearest[pick]; target <= 0 {
+					break
+				}
+			}
+		}
+		row(pick, func(j int, value float64) {
+			centroids[c][j] = value
+		})
+		length(c)
+	}
+
+	labels, counts := make([]int, n), make([]int, k)
+	for iteration := 0; iteration < kmeans.DefaultMaxIter; iteration++ {
+		changed := false
+		for i := range labels {
+			best, min := 0, math.Inf(1)
+			for c := range centroids {
+				if d := distance(i, c); d < min {
+					best, min = c, d
+				}
+			}
+			if best != labels[i] || iteration == 0 {
+				labels[i], changed = best, true
+			}
+		}
+		if !changed {
+			break
+		}
+		for c := range counts {
+			counts[c] = 0
+		}
+		for _, label := range labels {
+			counts[label]++
+		}
+		for c := range centroids {
+			// an empty cluster keeps its centroid
+			if counts[c] == 0 {
+				continue
+			}
+			for j := range centroids[c] {
+				centroids[c][j] = 0
+			}
+		}
+		for i, label := range labels {
+			scale := 1 / float64(counts[label])
+			row(i, func(j int, value float64) {
+				centroids[label][j] += value * scale
+			})
+		}
+		for c := range centroids {
+			length(c)
+		}
+	}
+	return labels, nil
+}
+
+// Linkage is an agglomerative clustering linkage criterion
+type Linkage int
+
+const (
+	// Single links clusters by their closest rows
+	Single Linkage = iota
+	// Complete links clusters by their farthest rows
+	Complete
+	// Average links clusters by the mean distance between their rows
+	Average
+)
+
+// Agglomerative returns a finisher that clusters with 1 - co-association as the distance
+func Agglomerative(linkage Linkage) Finisher {
+	return func(seed int64, coassociation Matrix, k int) ([]int, error) {
+		n := coassociation.Len()
+		if k < 1 || k > n {
+			return nil, fmt.Errorf("can't make %d clusters from %d rows", k, n)
+		}
+		// distance is the linkage distance between active clusters, pairs without an entry are at distance 1
+		distance := make([]map[int]float64, n)
+		for i := range distance {
+			distance[i] = make(map[int]float64)
+			coassociation.Row(i, func(j int, value float64) {
+				if d := 1 - value; d < 1 {
+					distance[i][j] = d
+				}
+			})
+		}
+		// parent is the cluster each row was merged into
+		parent, sizes, active := make([]int, n), make([]float64, n), make([]bool, n)
+		for i := range parent {
+			parent[i], sizes[i], active[i] = i, 1, true
+		}
+		// nearest is the closest cluster to each cluster, the lowest on ties, and closest is its distance
+		nearest, closest := make([]int, n), make([]float64, n)
+		find := func(i int) {
+			nearest[i], closest[i] = -1, 1
+			for j, d := range distance[i] {
+				if d < closest[i] || (d == closest[i] && j < nearest[i]) {
+					nearest[i], closest[i] = j, d
+				}
+			}
+		}
+		for i := range nearest {
+			find(i)
+		}
+		for clusters := n; clusters > k; clusters-- {
+			// a and b are the closest clusters, the first pair in row order on ties
+			a, b, min := -1, -1, 1.0
+			for i := 0; i < n; i++ {
+				if active[i] && nearest[i] >= 0 && closest[i] < min {
+					a, b, min = i, nearest[i], closest[i]
+				}
+			}
+			if a < 0 {
+				for i := 0; i < n && b < 0; i++ {
+					if !active[i] {
+						continue
+					} else if a < 0 {
+						a = i
+					} else {
+						b = i
+					}
+				}
+			}
+			merged := make(map[int]float64)
+			for _, neighbors := range []map[int]float64{distance[a], distance[b]} {
+				for i := range neighbors {
+					if i == a || i == b {
+						continue
+					}
+					if _, ok := merged[i]; ok {
+						continue
+					}
+					da, ok := distance[a][i]
+					if !ok {
+						da = 1
+					}
+					db, ok := distance[b][i]
+					if !ok {
+						db = 1
+					}
+					var d float64
+					switch linkage {
+					case Single:
+						d = math.Min(da, db)
+					case Complete:
+						d = math.Max(da, db)
+					case Average:
+						d = (sizes[a]*da + sizes[b]*db) / (sizes[a] + sizes[b])
+					}
+					merged[i] = d
+					delete(distance[i], b)
+					if d < 1 {
+						distance[i][a] = d
+					} else {
+						delete(distance[i], a)
+					}
+					if nearest[i] == a || nearest[i] == b {
+						find(i)
+					} else if d < closest[i] || (d < 1 && d == closest[i] && a < nearest[i]) {
+						nearest[i], closest[i] = a, d
+					}
+				}
+			}
+			for i, d := range merged {
+				if d >= 1 {
+					delete(merged, i)
+				}
+			}
+			distance[a], distance[b] = merged, nil
+			find(a)
+			sizes[a] += sizes[b]
+			active[b] = false
+			parent[b] = a
+		}
+		labels, index := make([]int, n), make(map[int]int)
+		for i := range labels {
+			root := i
+			for parent[root] != root {
+				root = parent[root]
+			}
+			label, ok := index[root]
+			if !ok {
+				label = len(index)
+				index[root] = label
+			}
+			labels[i] = label
+		}
+		return labels, nil
+	}
+}
+
+// Registry of finishers by name
+var finishers = struct {
+	sync.RWMutex
+	finishers map[string]Finisher
+}{
+	finishers: map[string]Finisher{
+		"kmeans":   KmeansFinisher,
+		"single":   Agglomerative(Single),
+		"complete": Agglomerative(Complete),
+		"average":  Agglomerative(Average),
+		"spectral": Spectral,
+	},
+}
+
+// RegisterFinisher registers a finisher under a name, replacing any finisher with that name
+func RegisterFinisher(name string, finisher Finisher) {
+	finishers.Lock()
+	defer finishers.Unlock()
+	finishers.finishers[name] = finisher
+}
+
+// ParseFinisher looks up a finisher by name, the empty name is kmeans
+func ParseFinisher(name string) (Finisher, error) {
+	if name == "" {
+		name = "kmeans"
+	}
+	finishers.RLock()
+	defer finishers.RUnlock()
+	finisher, ok := finishers.finishers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown finisher %q", name)
+	}
+	return finisher, nil
+}
+
+// FinisherNames are the names of the registered finishers in order
+func FinisherNames() []string {
+	finishers.RLock()
+	defer finishers.RUnlock()
+	names := make([]string, 0, len(finishers.finishers))
+	for name := range finishers.finishers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// finisher is the finisher of the config, or the registered finisher with its name
+func (c Config) finisher() (Finisher, error) {
+	if c.Finisher != nil {
+		return c.Finisher, nil
+	}
+	return ParseFinisher(c.FinisherName)
+}
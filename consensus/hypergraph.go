@@ -0,0 +1,324 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consensus
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hypergraph is a vertex and hyperedge weighted hypergraph
+type hypergraph struct {
+	// weights are the number of rows in each vertex
+	weights []int
+	// edges are the vertices of each hyperedge
+	edges [][]int
+	// costs are the number of hyperedges merged into each hyperedge
+	costs []int
+	// incidence are the hyperedges of each vertex
+	incidence [][]int
+}
+
+// newHypergraph builds a hypergraph, it drops hyperedges that can't be cut and merges duplicates
+func newHypergraph(weights []int, edges [][]int, costs []int) *hypergraph {
+	h := &hypergraph{
+		weights:   weights,
+		incidence: make([][]int, len(weights)),
+	}
+	index := make(map[string]int)
+	var key strings.Builder
+	for e, edge := range edges {
+		if len(edge) < 2 {
+			continue
+		}
+		sort.Ints(edge)
+		key.Reset()
+		for _, v := range edge {
+			key.WriteString(strconv.Itoa(v))
+			key.WriteByte(',')
+		}
+		if merged, ok := index[key.String()]; ok {
+			h.costs[merged] += costs[e]
+			continue
+		}
+		index[key.String()] = len(h.edges)
+		for _, v := range edge {
+			h.incidence[v] = append(h.incidence[v], len(h.edges))
+		}
+		h.edges = append(h.edges, edge)
+		h.costs = append(h.costs, costs[e])
+	}
+	return h
+}
+
+// coarsen merges pairs of vertices that share the most hyperedges into vertices of at most limit rows
+func (h *hypergraph) coarsen(rng *rand.Rand, limit int) (*hypergraph, []int) {
+	n := len(h.weights)
+	coarse, rating := make([]int, n), make([]float64, n)
+	for v := range coarse {
+		coarse[v] = -1
+	}
+	var weights, touched []int
+	for _, v := range rng.Perm(n) {
+		if coarse[v] >= 0 {
+			continue
+		}
+		touched = touched[:0]
+		for _, e := range h.incidence[v] {
+			share := float64(h.costs[e]) / float64(len(h.edges[e])-1)
+			for _, u := range h.edges[e] {
+				if u == v || coarse[u] >= 0 || h.weights[u]+h.weights[v] > limit {
+					continue
+				}
+				if rating[u] == 0 {
+					touched = append(touched, u)
+				}
+				rating[u] += share
+			}
+		}
+		match := -1
+		for _, u := range touched {
+			if match < 0 || rating[u] > rating[match] {
+				match = u
+			}
+			rating[u] = 0
+		}
+		coarse[v] = len(weights)
+		weight := h.weights[v]
+		if match >= 0 {
+			coarse[match] = len(weights)
+			weight += h.weights[match]
+		}
+		weights = append(weights, weight)
+	}
+	stamp := make([]int, len(weights))
+	for v := range stamp {
+		stamp[v] = -1
+	}
+	edges := make([][]int, len(h.edges))
+	for e, edge := range h.edges {
+		for _, v := range edge {
+			if c := coarse[v]; stamp[c] != e {
+				stamp[c] = e
+				edges[e] = append(edges[e], c)
+			}
+		}
+	}
+	costs := make([]int, len(h.costs))
+	copy(costs, h.costs)
+	return newHypergraph(weights, edges, costs), coarse
+}
+
+// grow builds an initial partition by growing each part from its heaviest vertex along the most shared hyperedges
+func (h *hypergraph) grow(k, upper int) []int {
+	n, total := len(h.weights), 0
+	parts, connection := make([]int, n), make([]int, n)
+	for v := range parts {
+		parts[v] = -1
+		total += h.weights[v]
+	}
+	reached := make([]int, len(h.edges))
+	for e := range reached {
+		reached[e] = -1
+	}
+	for p := 0; p < k-1; p++ {
+		for v := range connection {
+			connection[v] = 0
+		}
+		size := 0
+		for size*k < total {
+			best := -1
+			for v, part := range parts {
+				if part >= 0 || size+h.weights[v] > upper {
+					continue
+				}
+				if best < 0 || connection[v] > connection[best] ||
+					(connection[v] == connection[best] && h.weights[v] > h.weights[best]) {
+					best = v
+				}
+			}
+			if best < 0 {
+				break
+			}
+			parts[best], size = p, size+h.weights[best]
+			for _, e := range h.incidence[best] {
+				if reached[e] == p {
+					continue
+				}
+				reached[e] = p
+				for _, u := range h.edges[e] {
+					connection[u] += h.costs[e]
+				}
+			}
+		}
+	}
+	for v, part := range parts {
+		if part < 0 {
+			parts[v] = k - 1
+		}
+	}
+	return parts
+}
+
+// refine improves a partition with Fiduccia-Mattheyses passes that minimize the connectivity of the hyperedges,
+// each pass tentatively moves the vertex with the highest gain and rolls back to the best prefix of moves
+func (h *hypergraph) refine(parts []int, k, lower, upper int) {
+	n := len(h.weights)
+	sizes, pins := make([]int, k), make([][]int, len(h.edges))
+	for v, part := range parts {
+		sizes[part] += h.weights[v]
+	}
+	for e, edge := range h.edges {
+		pins[e] = make([]int, k)
+		for _, v := range edge {
+			pins[e][parts[v]]++
+		}
+	}
+	gains := make([][]int, n)
+	for v := range gains {
+		gains[v] = make([]int, k)
+	}
+	update := func(v int) {
+		from := parts[v]
+		for to := range gains[v] {
+			gains[v][to] = 0
+		}
+		for _, e := range h.incidence[v] {
+			leaves := 0
+			if pins[e][from] == 1 {
+				leaves = h.costs[e]
+			}
+			for to, count := range pins[e] {
+				if to == from {
+					continue
+				}
+				gains[v][to] += leaves
+				if count == 0 {
+					gains[v][to] -= h.costs[e]
+				}
+			}
+		}
+	}
+	for v := range gains {
+		update(v)
+	}
+	stamp := make([]int, n)
+	move := func(v, to, step int) {
+		from := parts[v]
+		for _, e := range h.incidence[v] {
+			// only the gains of vertices on hyperedges that enter or leave a part change
+			changed := pins[e][from] <= 2 || pins[e][to] <= 1
+			pins[e][from]--
+			pins[e][to]++
+			if !changed {
+				continue
+			}
+			for _, u := range h.edges[e] {
+				stamp[u] = step
+			}
+		}
+		parts[v] = to
+		sizes[from] -= h.weights[v]
+		sizes[to] += h.weights[v]
+		stamp[v] = step
+		for _, e := range h.incidence[v] {
+			for _, u := range h.edges[e] {
+				if stamp[u] == step {
+					stamp[u] = -step
+					update(u)
+				}
+			}
+		}
+		if stamp[v] == step {
+			update(v)
+		}
+	}
+	type moved struct {
+		vertex, from int
+	}
+	locked, step := make([]bool, n), 0
+	for pass := 0; pass < HGPAPasses; pass++ {
+		for v := range locked {
+			locked[v] = false
+		}
+		var moves []moved
+		total, best, prefix := 0, 0, 0
+		for len(moves)-prefix < HGPAStall {
+			vertex, target := -1, -1
+			for v, gain := range gains {
+				if locked[v] || sizes[parts[v]]-h.weights[v] < lower {
+					continue
+				}
+				for to := range gain {
+					if to == parts[v] || sizes[to]+h.weights[v] > upper {
+						continue
+					}
+					if vertex < 0 || gain[to] > gains[vertex][target] {
+						vertex, target = v, to
+					}
+				}
+			}
+			if vertex < 0 {
+				break
+			}
+			total += gains[vertex][target]
+			moves = append(moves, moved{vertex, parts[vertex]})
+			locked[vertex] = true
+			step++
+			move(vertex, target, step)
+			if total > best {
+				best, prefix = total, len(moves)
+			}
+		}
+		for i := len(moves) - 1; i >= prefix; i-- {
+			step++
+			move(moves[i].vertex, moves[i].from, step)
+		}
+		if best == 0 {
+			break
+		}
+	}
+}
+
+// partition splits the hypergraph into k parts of balanced weight that cut the fewest hyperedges,
+// it coarsens the hypergraph, partitions the coarsest level, and refines the partition at each level back up
+func (h *hypergraph) partition(rng *rand.Rand, k int) []int {
+	total := 0
+	for _, weight := range h.weights {
+		total += weight
+	}
+	lower := int((1 - HGPAImbalance) * float64(total) / float64(k))
+	upper := int((1+HGPAImbalance)*float64(total)/float64(k)) + 1
+	limit := upper / 4
+	if limit < 1 {
+		limit = 1
+	}
+	levels, maps := []*hypergraph{h}, [][]int(nil)
+	for coarsest := h; len(coarsest.weights) > HGPACoarsest*k; {
+		coarse, mapping := coarsest.coarsen(rng, limit)
+		if len(coarse.weights) == len(coarsest.weights) {
+			break
+		}
+		levels, maps = append(levels, coarse), append(maps, mapping)
+		if 10*len(coarse.weights) > 9*len(coarsest.weights) {
+			break
+		}
+		coarsest = coarse
+	}
+	coarsest := levels[len(levels)-1]
+	parts := coarsest.grow(k, upper)
+	coarsest.refine(parts, k, lower, upper)
+	for level := len(levels) - 2; level >= 0; level-- {
+		fine := make([]int, len(levels[level].weights))
+		for v, c := range maps[level] {
+			fine[v] = parts[c]
+		}
+		parts = fine
+		levels[level].refine(parts, k, lower, upper)
+	}
+	return parts
+}
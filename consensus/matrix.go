@@ -0,0 +1,413 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consensus
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// StoragePacked stores every pair in an upper triangular matrix of counts
+	StoragePacked = "packed"
+	// StorageSparse only stores the pairs that can reach the threshold
+	StorageSparse = "sparse"
+)
+
+var (
+	// ErrOverflow means there are more labelings than the counts can hold
+	ErrOverflow = errors.New("too many labelings for 16 bit counts")
+)
+
+// Matrix is a symmetric similarity matrix
+type Matrix interface {
+	// Len is the number of rows
+	Len() int
+	// At is the similarity of rows i and j
+	At(i, j int) float64
+	// Row calls f for each entry of row i off the diagonal that may be non-zero
+	Row(i int, f func(j int, value float64))
+}
+
+// Accumulator is a co-association matrix that is built one base labeling at a time
+type Accumulator interface {
+	Matrix
+	// Add adds a base labeling
+	Add(labels []int) error
+}
+
+// Dense is a dense similarity matrix
+type Dense [][]float64
+
+// Len is the number of rows
+func (d Dense) Len() int {
+	return len(d)
+}
+
+// At is the similarity of rows i and j
+func (d Dense) At(i, j int) float64 {
+	return d[i][j]
+}
+
+// Row calls f for each entry of row i off the diagonal
+func (d Dense) Row(i int, f func(j int, value float64)) {
+	for j, value := range d[i] {
+		if j != i {
+			f(j, value)
+		}
+	}
+}
+
+// Adjacency is a sparse similarity matrix with a map of the non-zero entries off the diagonal of each row and 1 on the diagonal
+type Adjacency []map[int]float64
+
+// Len is the number of rows
+func (a Adjacency) Len() int {
+	return len(a)
+}
+
+// At is the similarity of rows i and j
+func (a Adjacency) At(i, j int) float64 {
+	if i == j {
+		return 1
+	}
+	return a[i][j]
+}
+
+// Row calls f for each non-zero entry of row i in column order
+func (a Adjacency) Row(i int, f func(j int, value float64)) {
+	columns := make([]int, 0, len(a[i]))
+	for j := range a[i] {
+		columns = append(columns, j)
+	}
+	sort.Ints(columns)
+	for _, j := range columns {
+		f(j, a[i][j])
+	}
+}
+
+// ToDense copies a matrix into a dense matrix
+func ToDense(m Matrix) Dense {
+	if d, ok := m.(Dense); ok {
+		return d
+	}
+	d := make(Dense, m.Len())
+	for i := range d {
+		d[i] = make([]float64, m.Len())
+		d[i][i] = m.At(i, i)
+		m.Row(i, func(j int, value float64) {
+			d[i][j] = value
+		})
+	}
+	return d
+}
+
+// members groups the rows that are present by cluster
+func members(labels []int) [][]int {
+	index := make(map[int]int)
+	groups := make([][]int, 0, 8)
+	for i, label := range labels {
+		if label == Missing {
+			continue
+		}
+		group, ok := index[label]
+		if !ok {
+			group = len(groups)
+			index[label] = group
+			groups = append(groups, nil)
+		}
+		groups[group] = append(groups[group], i)
+	}
+	return groups
+}
+
+// Packed is a co-association matrix of 16 bit counts stored as a packed upper triangle
+type Packed struct {
+	n     int
+	runs  int
+	rows  []uint16
+	pairs []uint16
+	// sampled counts the labelings with both rows present, nil until a labeling has missing rows
+	sampled []uint16
+}
+
+// NewPacked creates a packed co-association matrix for n rows
+func NewPacked(n int) *Packed {
+	return &Packed{
+		n:     n,
+		rows:  make([]uint16, n),
+		pairs: make([]uint16, n*(n-1)/2),
+	}
+}
+
+// index is the offset of pair i < j in the packed triangle
+func (p *Packed) index(i, j int) int {
+	return i*p.n - i*(i+1)/2 + j - i - 1
+}
+
+// Len is the number of rows
+func (p *Packed) Len() int {
+	return p.n
+}
+
+// Add adds a base labeling
+func (p *Packed) Add(labels []int) error {
+	if len(labels) != p.n {
+		return fmt.Errorf("labeling has %d rows, want %d", len(labels), p.n)
+	}
+	if p.runs == math.MaxUint16 {
+		return ErrOverflow
+	}
+	present := make([]int, 0, p.n)
+	for i, label := range labels {
+		if label != Missing {
+			present = append(present, i)
+		}
+	}
+	if len(present) < p.n && p.sampled == nil {
+		p.sampled = make([]uint16, len(p.pairs))
+		for i := range p.sampled {
+			p.sampled[i] = uint16(p.runs)
+		}
+	}
+	if p.sampled != nil {
+		for a, i := range present {
+			for _, j := range present[a+1:] {
+				p.sampled[p.index(i, j)]++
+			}
+		}
+	}
+	for _, i := range present {
+		p.rows[i]++
+	}
+	for _, group := range members(labels) {
+		for a, i := range group {
+			for _, j := range group[a+1:] {
+				p.pairs[p.index(i, j)]++
+			}
+		}
+	}
+	p.runs++
+	return nil
+}
+
+// At is the fraction of the labelings with both rows present in which they are clustered together
+func (p *Packed) At(i, j int) float64 {
+	if i == j {
+		if p.rows[i] == 0 {
+			return 0
+		}
+		return 1
+	}
+	if i > j {
+		i, j = j, i
+	}
+	index := p.index(i, j)
+	sampled := p.runs
+	if p.sampled != nil {
+		sampled = int(p.sampled[index])
+	}
+	if sampled == 0 {
+		return 0
+	}
+	return float64(p.pairs[index]) / float64(sampled)
+}
+
+// Row calls f for each entry of row i off the diagonal
+func (p *Packed) Row(i int, f func(j int, value float64)) {
+	for j := 0; j < p.n; j++ {
+		if j != i {
+			f(j, p.At(i, j))
+		}
+	}
+}
+
+// Sparse is a co-association matrix that only keeps the pairs clustered together in at least a threshold fraction of the labelings
+// with both rows present, it stores the upper triangle and drops a pair as soon as it can no longer reach the threshold
+type Sparse struct {
+	n         int
+	runs      int
+	resamples int
+	threshold float64
+	// together counts the labelings that cluster rows i < j together, keyed by j in row i
+	together []map[int32]uint16
+	// present is a bitset per row of the labelings it is present in, nil until a labeling has missing rows
+	present [][]uint64
+	// deadlines are the pairs due to be checked after each labeling, the earliest labeling they could drop below the threshold
+	deadlines [][][2]int32
+	// columns are the stored columns of each row in order, built on demand after the last labeling
+	columns [][]int32
+}
+
+// NewSparse creates a sparse co-association matrix for n rows and the expected number of labelings
+func NewSparse(n, resamples int, threshold float64) (*Sparse, error) {
+	if resamples <= 0 || resamples > math.MaxUint16 {
+		return nil, ErrOverflow
+	}
+	s := &Sparse{
+		n:         n,
+		resamples: resamples,
+		threshold: threshold,
+		together:  make([]map[int32]uint16, n),
+		deadlines: make([][][2]int32, resamples+1),
+	}
+	for i := range s.together {
+		s.together[i] = make(map[int32]uint16)
+	}
+	return s, nil
+}
+
+// Len is the number of rows
+func (s *Sparse) Len() int {
+	return s.n
+}
+
+// sampled is the number of labelings with both rows present
+func (s *Sparse) sampled(i, j int) int {
+	if s.present == nil {
+		return s.runs
+	}
+	count := 0
+	for w, word := range s.present[i] {
+		count += bits.OnesCount64(word & s.present[j][w])
+	}
+	return count
+}
+
+// slack is how far the pair is above the threshold if it's clustered together in all of the remaining labelings,
+// each labeling lowers it by at most 1
+func (s *Sparse) slack(together, sampled int) float64 {
+	remaining := s.resamples - s.runs
+	return float64(together+remaining) - s.threshold*float64(sampled+remaining)
+}
+
+// schedule queues the pair for a check at the earliest labeling it could drop below the threshold
+func (s *Sparse) schedule(i, j int, slack float64) {
+	if deadline := s.runs + int(slack) + 1; deadline <= s.resamples {
+		s.deadlines[deadline] = append(s.deadlines[deadline], [2]int32{int32(i), int32(j)})
+	}
+}
+
+// Add adds a base labeling, dropping pairs that can no longer reach the threshold
+func (s *Sparse) Add(labels []int) error {
+	if len(labels) != s.n {
+		return fmt.Errorf("labeling has %d rows, want %d", len(labels), s.n)
+	}
+	if s.runs == s.resamples {
+		return fmt.Errorf("more than the expected %d labelings", s.resamples)
+	}
+	missing := false
+	for _, label := range labels {
+		if label == Missing {
+			missing = true
+			break
+		}
+	}
+	if missing && s.present == nil {
+		s.present = make([][]uint64, s.n)
+		for i := range s.present {
+			s.present[i] = make([]uint64, (s.resamples+63)/64)
+			for r := 0; r < s.runs; r++ {
+				s.present[i][r/64] |= 1 << (r % 64)
+			}
+		}
+	}
+	if s.present != nil {
+		for i, label := range labels {
+			if label != Missing {
+				s.present[i][s.runs/64] |= 1 << (s.runs % 64)
+			}
+		}
+	}
+	s.runs++
+	s.columns = nil
+	for _, group := range members(labels) {
+		for a, i := range group {
+			row := s.together[i]
+			for _, j := range group[a+1:] {
+				if count, ok := row[int32(j)]; ok {
+					row[int32(j)] = count + 1
+					continue
+				}
+				slack := s.slack(1, s.sampled(i, j))
+				if slack < 0 {
+					continue
+				}
+				row[int32(j)] = 1
+				s.schedule(i, j, slack)
+			}
+		}
+	}
+	due := s.deadlines[s.runs]
+	s.deadlines[s.runs] = nil
+	for _, pair := range due {
+		i, j := int(pair[0]), int(pair[1])
+		slack := s.slack(int(s.together[i][pair[1]]), s.sampled(i, j))
+		if slack < 0 {
+			delete(s.together[i], pair[1])
+			continue
+		}
+		s.schedule(i, j, slack)
+	}
+	return nil
+}
+
+// At is the fraction of the labelings with both rows present in which rows i and j are clustered together, zero below the threshold
+func (s *Sparse) At(i, j int) float64 {
+	if i == j {
+		if s.runs == 0 || (s.present != nil && s.sampled(i, i) == 0) {
+			return 0
+		}
+		return 1
+	}
+	if i > j {
+		i, j = j, i
+	}
+	count, ok := s.together[i][int32(j)]
+	if !ok {
+		return 0
+	}
+	sampled := s.sampled(i, j)
+	if sampled == 0 || float64(count) < s.threshold*float64(sampled) {
+		return 0
+	}
+	return float64(count) / float64(sampled)
+}
+
+// Row calls f for each stored entry of row i in column order
+func (s *Sparse) Row(i int, f func(j int, value float64)) {
+	if s.columns == nil {
+		// rows are visited in order so the lower columns of each row are sorted before its upper columns are appended
+		s.columns = make([][]int32, s.n)
+		for a, row := range s.together {
+			upper := make([]int32, 0, len(row))
+			for b := range row {
+				upper = append(upper, b)
+				s.columns[b] = append(s.columns[b], int32(a))
+			}
+			sort.Slice(upper, func(x, y int) bool {
+				return upper[x] < upper[y]
+			})
+			s.columns[a] = append(s.columns[a], upper...)
+		}
+	}
+	for _, j := range s.columns[i] {
+		if value := s.At(i, int(j)); value > 0 {
+			f(int(j), value)
+		}
+	}
+}
+
+// Entries is the number of stored pairs
+func (s *Sparse) Entries() int {
+	entries := 0
+	for _, row := range s.together {
+		entries += len(row)
+	}
+	return entries
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consensus
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/pointlander/ultra/metrics"
+)
+
+// noisy makes labelings of k clusters of size rows with a fraction of the rows moved and a fraction missing
+func noisy(rng *rand.Rand, labels []int, k, resamples int, noise, missing float64) [][]int {
+	labelings := make([][]int, resamples)
+	for r := range labelings {
+		labelings[r] = relabeled(rng, labels, k)
+		for i := range labelings[r] {
+			if rng.Float64() < noise {
+				labelings[r][i] = rng.Intn(k)
+			}
+			if rng.Float64() < missing {
+				labelings[r][i] = Missing
+			}
+		}
+	}
+	return labelings
+}
+
+func TestSparse(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	labels := truth(rng, 3, 30)
+	for _, missing := range []float64{0, 0.2} {
+		for _, threshold := range []float64{0, 0.3, 0.6} {
+			labelings := noisy(rng, labels, 3, 20, 0.3, missing)
+			packed := NewPacked(len(labels))
+			sparse, err := NewSparse(len(labels), len(labelings), threshold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, labeling := range labelings {
+				if err := packed.Add(labeling); err != nil {
+					t.Fatal(err)
+				}
+				if err := sparse.Add(labeling); err != nil {
+					t.Fatal(err)
+				}
+			}
+			kept := 0
+			for i := range labels {
+				if a, b := packed.At(i, i), sparse.At(i, i); a != b {
+					t.Fatalf("missing=%v threshold=%v diagonal %d is %f, want %f", missing, threshold, i, b, a)
+				}
+				for j := range labels {
+					want := packed.At(i, j)
+					if want < threshold {
+						want = 0
+					}
+					if got := sparse.At(i, j); got != want {
+						t.Fatalf("missing=%v threshold=%v pair (%d, %d) is %f, want %f", missing, threshold, i, j, got, want)
+					}
+					if i < j && want > 0 {
+						kept++
+					}
+				}
+				sum, want := 0.0, 0.0
+				sparse.Row(i, func(j int, value float64) {
+					sum += value
+				})
+				for j := range labels {
+					if j != i {
+						want += sparse.At(i, j)
+					}
+				}
+				if sum != want {
+					t.Fatalf("missing=%v threshold=%v row %d sums to %f, want %f", missing, threshold, i, sum, want)
+				}
+			}
+			// every pair that can't reach the threshold is dropped by the last labeling
+			if entries := sparse.Entries(); entries != kept {
+				t.Errorf("missing=%v threshold=%v %d entries, want %d", missing, threshold, entries, kept)
+			}
+		}
+	}
+}
+
+func TestFinishers(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	labels := truth(rng, 4, 25)
+	labelings := noisy(rng, labels, 4, 30, 0.1, 0.1)
+	packed, err := CoAssociation(labelings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sparse, err := NewSparse(len(labels), len(labelings), 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, labeling := range labelings {
+		if err := sparse.Add(labeling); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range FinisherNames() {
+		finisher, err := ParseFinisher(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, matrix := range []Matrix{packed, sparse} {
+			consensus, err := finisher(1, matrix, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			scores, err := metrics.Compare(labels, consensus)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if scores.ARI != 1 {
+				t.Errorf("%s finisher on %T has ari %f, want 1", name, matrix, scores.ARI)
+			}
+		}
+	}
+}
+
+func TestSparseSubsample(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	data := make([][]float64, 90)
+	for i := range data {
+		data[i] = []float64{float64(i/30) * 10, rng.NormFloat64()}
+	}
+	result, err := Cluster(data, 3, Config{Resamples: 20, Subsample: 0.8, Storage: StorageSparse, Threshold: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range data {
+		if result.Labels[i] != result.Labels[i/30*30] {
+			t.Fatalf("row %d is in cluster %d, want %d", i, result.Labels[i], result.Labels[i/30*30])
+		}
+	}
+}
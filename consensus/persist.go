@@ -0,0 +1,126 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consensus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ResultVersion is the version of the saved result format
+const ResultVersion = 1
+
+// resultMagic starts the binary encoding of a result
+var resultMagic = []byte("ULCR")
+
+// ErrVersion means a saved result is from an unsupported version of the format
+var ErrVersion = errors.New("unsupported result version")
+
+// savedResult is the saved form of a result, the co-association matrix and base labelings are only kept as the summary
+type savedResult struct {
+	Version  int                `json:"version"`
+	Labels   []int              `json:"labels"`
+	Seeds    []int64            `json:"seeds,omitempty"`
+	Combiner string             `json:"combiner"`
+	ANMI     map[string]float64 `json:"anmi"`
+	Config   Config             `json:"config"`
+	Summary  Summary            `json:"summary"`
+}
+
+// save converts the result to its saved form
+func (r *Result) save() savedResult {
+	return savedResult{
+		Version:  ResultVersion,
+		Labels:   r.Labels,
+		Seeds:    r.Seeds,
+		Combiner: r.Combiner,
+		ANMI:     r.ANMI,
+		Config:   r.Config,
+		Summary:  r.Summary,
+	}
+}
+
+// load sets the result from its saved form
+func (r *Result) load(saved savedResult) error {
+	if saved.Version != ResultVersion {
+		return fmt.Errorf("%w %d", ErrVersion, saved.Version)
+	}
+	*r = Result{
+		Labels:   saved.Labels,
+		Seeds:    saved.Seeds,
+		Combiner: saved.Combiner,
+		ANMI:     saved.ANMI,
+		Config:   saved.Config,
+		Summary:  saved.Summary,
+	}
+	return nil
+}
+
+// MarshalJSON encodes the result as versioned JSON
+func (r *Result) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.save())
+}
+
+// UnmarshalJSON decodes a result from versioned JSON, the co-association matrix and base labelings are nil
+func (r *Result) UnmarshalJSON(data []byte) error {
+	var saved savedResult
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	return r.load(saved)
+}
+
+// MarshalBinary encodes the result as a magic number, a version and a gob
+func (r *Result) MarshalBinary() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.Write(resultMagic)
+	binary.Write(&buffer, binary.LittleEndian, uint16(ResultVersion))
+	if err := gob.NewEncoder(&buffer).Encode(r.save()); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a result encoded by MarshalBinary, the co-association matrix and base labelings are nil
+func (r *Result) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, resultMagic) {
+		return errors.New("not a binary result")
+	}
+	data = data[len(resultMagic):]
+	if len(data) < 2 {
+		return io.ErrUnexpectedEOF
+	}
+	if version := binary.LittleEndian.Uint16(data); version != ResultVersion {
+		return fmt.Errorf("%w %d", ErrVersion, version)
+	}
+	var saved savedResult
+	if err := gob.NewDecoder(bytes.NewReader(data[2:])).Decode(&saved); err != nil {
+		return err
+	}
+	return r.load(saved)
+}
+
+// ReadResult reads a result saved as JSON or binary
+func ReadResult(r io.Reader) (*Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = result.UnmarshalJSON(trimmed)
+	} else {
+		err = result.UnmarshalBinary(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
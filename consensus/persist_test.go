@@ -0,0 +1,61 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consensus
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestResultPersist(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := make([][]float64, 30)
+	for i := range data {
+		data[i] = []float64{float64(i%2) * 10, rng.NormFloat64()}
+	}
+	result, err := Cluster(data, 2, Config{Resamples: 5, Init: "kmeans||", FinisherName: "average"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Config.Init != "kmeans||" || result.Config.FinisherName != "average" || result.Config.Distance != "sqeuclidean" {
+		t.Fatalf("config %+v doesn't name its init, finisher and distance", result.Config)
+	}
+	for _, marshal := range []func() ([]byte, error){result.MarshalJSON, result.MarshalBinary} {
+		encoded, err := marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := ReadResult(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded.Config.Clusterer, result.Config.Clusterer = nil, nil
+		if !reflect.DeepEqual(loaded.Config, result.Config) {
+			t.Errorf("loaded config %+v, want %+v", loaded.Config, result.Config)
+		}
+		if !reflect.DeepEqual(loaded.Labels, result.Labels) {
+			t.Errorf("loaded labels %v, want %v", loaded.Labels, result.Labels)
+		}
+	}
+}
+
+// A finisher func in the config is used instead of the named finisher
+func TestConfigFinisher(t *testing.T) {
+	labelings := [][]int{{0, 0, 1, 1}, {0, 0, 1, 1}}
+	called := false
+	finisher := func(seed int64, coassociation Matrix, k int) ([]int, error) {
+		called = true
+		return []int{0, 1, 0, 1}, nil
+	}
+	result, err := Combine(labelings, 2, Config{Finisher: finisher, FinisherName: "unknown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called || !reflect.DeepEqual(result.Labels, []int{0, 1, 0, 1}) {
+		t.Errorf("labels %v, want the labels of the config finisher", result.Labels)
+	}
+}
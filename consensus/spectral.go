@@ -0,0 +1,117 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consensus
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/pointlander/ultra/kmeans"
+)
+
+const (
+	// SpectralIterations is the maximum number of orthogonal iterations
+	SpectralIterations = 1000
+	// SpectralTolerance is the change in the eigenvectors at which orthogonal iteration stops
+	SpectralTolerance = 1e-9
+)
+
+// orthonormalize makes the vectors orthonormal with Gram-Schmidt
+func orthonormalize(vectors [][]float64) {
+	for i, v := range vectors {
+		for _, u := range vectors[:i] {
+			dot := 0.0
+			for j := range v {
+				dot += v[j] * u[j]
+			}
+			for j := range v {
+				v[j] -= dot * u[j]
+			}
+		}
+		norm := 0.0
+		for _, value := range v {
+			norm += value * value
+		}
+		norm = math.Sqrt(norm)
+		if norm == 0 {
+			continue
+		}
+		for j := range v {
+			v[j] /= norm
+		}
+	}
+}
+
+// Spectral clusters with the co-association matrix as the affinity using normalized spectral clustering
+func Spectral(seed int64, coassociation Matrix, k int) ([]int, error) {
+	n := coassociation.Len()
+	if k < 1 || k > n {
+		return nil, fmt.Errorf("can't make %d clusters from %d rows", k, n)
+	}
+	degree := make([]float64, n)
+	for i := range degree {
+		coassociation.Row(i, func(j int, value float64) {
+			degree[i] += value
+		})
+		if degree[i] > 0 {
+			degree[i] = 1 / math.Sqrt(degree[i])
+		}
+	}
+	// multiply by I + D^-1/2 A D^-1/2 which has the same eigenvectors and non negative eigenvalues
+	multiply := func(v, out []float64) {
+		for i := range out {
+			sum := v[i]
+			coassociation.Row(i, func(j int, value float64) {
+				sum += degree[i] * value * degree[j] * v[j]
+			})
+			out[i] = sum
+		}
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	vectors, next := make([][]float64, k), make([][]float64, k)
+	for i := range vectors {
+		vectors[i], next[i] = make([]float64, n), make([]float64, n)
+		for j := range vectors[i] {
+			vectors[i][j] = rng.NormFloat64()
+		}
+	}
+	orthonormalize(vectors)
+	for iteration := 0; iteration < SpectralIterations; iteration++ {
+		for i := range vectors {
+			multiply(vectors[i], next[i])
+		}
+		orthonormalize(next)
+		change := 0.0
+		for i := range vectors {
+			for j := range vectors[i] {
+				diff := math.Abs(vectors[i][j]) - math.Abs(next[i][j])
+				change += diff * diff
+			}
+		}
+		vectors, next = next, vectors
+		if change < SpectralTolerance {
+			break
+		}
+	}
+
+	embedding := make([][]float64, n)
+	for i := range embedding {
+		embedding[i] = make([]float64, k)
+		norm := 0.0
+		for j := range vectors {
+			embedding[i][j] = vectors[j][i]
+			norm += vectors[j][i] * vectors[j][i]
+		}
+		if norm = math.Sqrt(norm); norm > 0 {
+			for j := range embedding[i] {
+				embedding[i][j] /= norm
+			}
+		}
+	}
+	result, err := kmeans.Fit(embedding, k, kmeans.SquaredEuclideanDistance, kmeans.Options{Seed: seed, Workers: 1, Squared: true})
+	return result.Labels, err
+}
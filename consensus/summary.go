@@ -0,0 +1,51 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package consensus
+
+// Summary summarizes a co-association matrix for a labeling
+type Summary struct {
+	// Sizes are the number of rows in each cluster
+	Sizes []int `json:"sizes"`
+	// ClusterConsensus is the mean co-association of the pairs in each cluster, zero for single row clusters
+	ClusterConsensus []float64 `json:"cluster_consensus"`
+	// ItemConsensus is the mean co-association of each row with the other rows of its cluster, zero for single row clusters
+	ItemConsensus []float64 `json:"item_consensus"`
+}
+
+// Summarize computes the cluster and item consensus of the labels
+func Summarize(labels []int, coassociation Matrix) Summary {
+	k := 0
+	for _, label := range labels {
+		if label+1 > k {
+			k = label + 1
+		}
+	}
+	summary := Summary{
+		Sizes:            make([]int, k),
+		ClusterConsensus: make([]float64, k),
+		ItemConsensus:    make([]float64, len(labels)),
+	}
+	for _, label := range labels {
+		summary.Sizes[label]++
+	}
+	for i, label := range labels {
+		sum := 0.0
+		coassociation.Row(i, func(j int, value float64) {
+			if labels[j] == label {
+				sum += value
+			}
+		})
+		if others := summary.Sizes[label] - 1; others > 0 {
+			summary.ItemConsensus[i] = sum / float64(others)
+		}
+		summary.ClusterConsensus[label] += sum
+	}
+	for c, size := range summary.Sizes {
+		if size > 1 {
+			summary.ClusterConsensus[c] /= float64(size * (size - 1))
+		}
+	}
+	return summary
+}
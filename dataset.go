@@ -0,0 +1,404 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// NoColumn means a column is not present
+const NoColumn = -1
+
+var (
+	// ErrEmpty means there are no rows in the data set
+	ErrEmpty = errors.New("data set is empty")
+	// ErrNoFeatures means no feature columns were selected
+	ErrNoFeatures = errors.New("no feature columns")
+)
+
+// ParseError is a value that is not a number
+type ParseError struct {
+	Line   int
+	Column int
+	Value  string
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: can't parse %q: %v", e.Line, e.Column, e.Value, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ColumnError is a reference to a column that does not exist
+type ColumnError struct {
+	Column int
+	Width  int
+}
+
+func (e *ColumnError) Error() string {
+	return fmt.Sprintf("column %d out of range, rows have %d columns", e.Column, e.Width)
+}
+
+// ShapeError is a size that does not match the data set
+type ShapeError struct {
+	What string
+	Row  int
+	Got  int
+	Want int
+}
+
+func (e *ShapeError) Error() string {
+	if e.Row >= 0 {
+		return fmt.Sprintf("%s of row %d has length %d, want %d", e.What, e.Row, e.Got, e.Want)
+	}
+	return fmt.Sprintf("%s has length %d, want %d", e.What, e.Got, e.Want)
+}
+
+// Header is the header row mode
+type Header int
+
+const (
+	// HeaderAuto detects the header row
+	HeaderAuto Header = iota
+	// HeaderPresent means the first row is a header
+	HeaderPresent
+	// HeaderAbsent means there is no header row
+	HeaderAbsent
+)
+
+// ParseHeader parses a header mode
+func ParseHeader(mode string) (Header, error) {
+	switch mode {
+	case "auto", "":
+		return HeaderAuto, nil
+	case "yes", "true":
+		return HeaderPresent, nil
+	case "no", "false":
+		return HeaderAbsent, nil
+	}
+	return HeaderAuto, fmt.Errorf("unknown header mode %q", mode)
+}
+
+// ParseColumns parses a list of columns such as 0,2-4
+func ParseColumns(spec string) ([]int, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	columns := make([]int, 0, 8)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		from, to, found := strings.Cut(part, "-")
+		a, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("bad column %q: %w", part, err)
+		}
+		b := a
+		if found {
+			b, err = strconv.Atoi(to)
+			if err != nil {
+				return nil, fmt.Errorf("bad column %q: %w", part, err)
+			}
+		}
+		if a < 0 || b < a {
+			return nil, fmt.Errorf("bad column range %q", part)
+		}
+		for i := a; i <= b; i++ {
+			columns = append(columns, i)
+		}
+	}
+	return columns, nil
+}
+
+// LoadOptions are options for loading a data set
+// The zero value loads every column as a feature with an auto detected header and no label or id
+type LoadOptions struct {
+	// Comma is the field delimiter, zero picks one from the file extension
+	Comma rune
+	// Header is the header row mode
+	Header Header
+	// Label is the label column, nil for none
+	Label *int
+	// ID is the row id column, nil for none
+	ID *int
+	// Columns are the feature columns, nil selects every column but the label and id
+	Columns []int
+	// Names are the names of all the columns when there is no header
+	Names []string
+}
+
+// Column is a label or id column option, NoColumn or any negative column is none
+func Column(column int) *int {
+	if column < 0 {
+		return nil
+	}
+	return &column
+}
+
+// Dataset is a set of numeric observations
+type Dataset struct {
+	// Names are the feature names
+	Names []string
+	// IDs are the row ids
+	IDs []string
+	// Features are the feature vectors, one per row
+	Features [][]float64
+	// Classes are the distinct ground truth labels in order of appearance
+	Classes []string
+	// Targets are the ground truth class of each row, nil if there are no labels
+	Targets []int
+}
+
+// Rows is the number of rows
+func (d *Dataset) Rows() int {
+	return len(d.Features)
+}
+
+// Width is the number of features
+func (d *Dataset) Width() int {
+	if len(d.Features) == 0 {
+		return 0
+	}
+	return len(d.Features[0])
+}
+
+// Validate checks that the shape of the data set is consistent
+func (d *Dataset) Validate() error {
+	rows, width := d.Rows(), d.Width()
+	if rows == 0 {
+		return ErrEmpty
+	}
+	if width == 0 {
+		return ErrNoFeatures
+	}
+	for i, row := range d.Features {
+		if len(row) != width {
+			return &ShapeError{What: "features", Row: i, Got: len(row), Want: width}
+		}
+	}
+	if d.Names != nil && len(d.Names) != width {
+		return &ShapeError{What: "names", Row: -1, Got: len(d.Names), Want: width}
+	}
+	if d.IDs != nil && len(d.IDs) != rows {
+		return &ShapeError{What: "ids", Row: -1, Got: len(d.IDs), Want: rows}
+	}
+	if d.Targets != nil {
+		if len(d.Targets) != rows {
+			return &ShapeError{What: "targets", Row: -1, Got: len(d.Targets), Want: rows}
+		}
+		for i, target := range d.Targets {
+			if target < 0 || target >= len(d.Classes) {
+				return fmt.Errorf("target of row %d is %d but there are %d classes", i, target, len(d.Classes))
+			}
+		}
+	}
+	return nil
+}
+
+// Labeled is true if the data set has ground truth labels
+func (d *Dataset) Labeled() bool {
+	return d.Targets != nil
+}
+
+// Label returns the ground truth label of a row
+func (d *Dataset) Label(row int) string {
+	if d.Targets == nil {
+		return ""
+	}
+	return d.Classes[d.Targets[row]]
+}
+
+// SetLabels sets the ground truth labels, discovering the classes
+func (d *Dataset) SetLabels(labels []string) {
+	classes := make(map[string]int)
+	d.Classes = d.Classes[:0]
+	d.Targets = make([]int, len(labels))
+	for i, label := range labels {
+		class, ok := classes[label]
+		if !ok {
+			class = len(d.Classes)
+			classes[label] = class
+			d.Classes = append(d.Classes, label)
+		}
+		d.Targets[i] = class
+	}
+}
+
+// Copy returns a copy of the feature vectors
+func (d *Dataset) Copy() [][]float64 {
+	features := make([][]float64, len(d.Features))
+	for i, row := range d.Features {
+		features[i] = append(make([]float64, 0, len(row)), row...)
+	}
+	return features
+}
+
+// numeric checks if the selected columns of a record are numbers
+func numeric(record []string, columns []int) bool {
+	for _, column := range columns {
+		if column >= len(record) {
+			return false
+		}
+		if _, err := strconv.ParseFloat(strings.TrimSpace(record[column]), 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadCSV loads a data set from delimited text
+func LoadCSV(input io.Reader, options LoadOptions) (*Dataset, error) {
+	reader := csv.NewReader(input)
+	if options.Comma != 0 {
+		reader.Comma = options.Comma
+	}
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrEmpty
+	}
+
+	width := len(records[0])
+	label, id := NoColumn, NoColumn
+	if options.Label != nil {
+		label = *options.Label
+		if label < 0 || label >= width {
+			return nil, &ColumnError{Column: label, Width: width}
+		}
+	}
+	if options.ID != nil {
+		id = *options.ID
+		if id < 0 || id >= width {
+			return nil, &ColumnError{Column: id, Width: width}
+		}
+	}
+	if label != NoColumn && label == id {
+		return nil, fmt.Errorf("column %d can't be both the label and the id", label)
+	}
+	columns := options.Columns
+	if columns == nil {
+		for i := 0; i < width; i++ {
+			if i != label && i != id {
+				columns = append(columns, i)
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return nil, ErrNoFeatures
+	}
+	for _, column := range columns {
+		if column < 0 || column >= width {
+			return nil, &ColumnError{Column: column, Width: width}
+		}
+	}
+
+	header := options.Header == HeaderPresent ||
+		(options.Header == HeaderAuto && !numeric(records[0], columns))
+	names := options.Names
+	line := 1
+	if header {
+		names, records = records[0], records[1:]
+		line++
+	}
+	if len(records) == 0 {
+		return nil, ErrEmpty
+	}
+
+	data := &Dataset{
+		Names:    make([]string, len(columns)),
+		IDs:      make([]string, 0, len(records)),
+		Features: make([][]float64, 0, len(records)),
+	}
+	for i, column := range columns {
+		if column < len(names) {
+			data.Names[i] = strings.TrimSpace(names[column])
+		} else {
+			data.Names[i] = fmt.Sprintf("x%d", column)
+		}
+	}
+	var labels []string
+	if label != NoColumn {
+		labels = make([]string, 0, len(records))
+	}
+	for i, record := range records {
+		row := make([]float64, len(columns))
+		for j, column := range columns {
+			value := strings.TrimSpace(record[column])
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, &ParseError{Line: line + i, Column: column, Value: value, Err: err}
+			}
+			row[j] = f
+		}
+		data.Features = append(data.Features, row)
+		if id != NoColumn {
+			data.IDs = append(data.IDs, strings.TrimSpace(record[id]))
+		} else {
+			data.IDs = append(data.IDs, strconv.Itoa(i))
+		}
+		if labels != nil {
+			labels = append(labels, strings.TrimSpace(record[label]))
+		}
+	}
+	if labels != nil {
+		data.SetLabels(labels)
+	}
+	return data, nil
+}
+
+// LoadFile loads a data set from a file, - is stdin
+func LoadFile(name string, options LoadOptions) (*Dataset, error) {
+	if options.Comma == 0 {
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".tsv", ".tab":
+			options.Comma = '\t'
+		}
+	}
+	if name == "-" {
+		return LoadCSV(os.Stdin, options)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return LoadCSV(file, options)
+}
+
+// LoadIris loads the embedded iris data set
+func LoadIris() (*Dataset, error) {
+	data, err := Iris.ReadFile("iris.zip")
+	if err != nil {
+		return nil, err
+	}
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	iris, err := reader.Open("iris.data")
+	if err != nil {
+		return nil, err
+	}
+	defer iris.Close()
+	return LoadCSV(iris, LoadOptions{
+		Header: HeaderAbsent,
+		Label:  Column(4),
+		Names:  []string{"sepal length", "sepal width", "petal length", "petal width"},
+	})
+}
@@ -0,0 +1,198 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadZeroOptions(t *testing.T) {
+	data, err := LoadCSV(strings.NewReader("1,2\n3,4\n"), LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data.Features, [][]float64{{1, 2}, {3, 4}}) || data.Labeled() {
+		t.Errorf("features %v labeled %v, want every column as a feature without labels", data.Features, data.Labeled())
+	}
+	if !reflect.DeepEqual(data.Names, []string{"x0", "x1"}) || !reflect.DeepEqual(data.IDs, []string{"0", "1"}) {
+		t.Errorf("names %v ids %v, want generated names and row numbers", data.Names, data.IDs)
+	}
+}
+
+func TestLoadHeader(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		input  string
+		header Header
+		label  *int
+		names  []string
+		rows   int
+	}{
+		{"auto text", "a,b\n1,2\n3,4\n", HeaderAuto, nil, []string{"a", "b"}, 2},
+		{"auto numbers", "1,2\n3,4\n", HeaderAuto, nil, []string{"x0", "x1"}, 2},
+		{"present numbers", "1,2\n3,4\n", HeaderPresent, nil, []string{"1", "2"}, 1},
+		// a text label column doesn't make the first row a header
+		{"auto label", "1,x\n3,y\n", HeaderAuto, Column(1), []string{"x0"}, 2},
+	} {
+		data, err := LoadCSV(strings.NewReader(test.input), LoadOptions{Header: test.header, Label: test.label})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(data.Names, test.names) || data.Rows() != test.rows {
+			t.Errorf("%s: names %v and %d rows, want %v and %d", test.name, data.Names, data.Rows(), test.names, test.rows)
+		}
+	}
+	var parse *ParseError
+	_, err := LoadCSV(strings.NewReader("a,b\n1,2\n"), LoadOptions{Header: HeaderAbsent})
+	if !errors.As(err, &parse) || parse.Line != 1 {
+		t.Errorf("a text row without a header has error %v, want a parse error on line 1", err)
+	}
+}
+
+func TestLoadColumns(t *testing.T) {
+	input := "id,a,b,c,class\nr0,1,2,3,x\nr1,4,5,6,y\nr2,7,8,9,x\n"
+	columns, err := ParseColumns("1,3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := LoadCSV(strings.NewReader(input), LoadOptions{Label: Column(4), ID: Column(0), Columns: columns})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data.Names, []string{"a", "c"}) || !reflect.DeepEqual(data.Features, [][]float64{{1, 3}, {4, 6}, {7, 9}}) {
+		t.Errorf("names %v features %v, want columns a and c", data.Names, data.Features)
+	}
+	if !reflect.DeepEqual(data.IDs, []string{"r0", "r1", "r2"}) || !reflect.DeepEqual(data.Classes, []string{"x", "y"}) ||
+		!reflect.DeepEqual(data.Targets, []int{0, 1, 0}) {
+		t.Errorf("ids %v classes %v targets %v", data.IDs, data.Classes, data.Targets)
+	}
+
+	// every column but the label and id
+	data, err = LoadCSV(strings.NewReader(input), LoadOptions{Label: Column(4), ID: Column(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data.Names, []string{"a", "b", "c"}) {
+		t.Errorf("names %v, want a, b and c", data.Names)
+	}
+
+	for _, spec := range []string{"x", "3-1", "-1", "1-y"} {
+		if _, err := ParseColumns(spec); err == nil {
+			t.Errorf("columns %q have no error", spec)
+		}
+	}
+	if columns, err := ParseColumns("0,2-4"); err != nil || !reflect.DeepEqual(columns, []int{0, 2, 3, 4}) {
+		t.Errorf("columns 0,2-4 are %v with error %v", columns, err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	input := "a,b,c\n1,2,x\n3,4,y\n5,oops,z\n"
+	var column *ColumnError
+	for _, options := range []LoadOptions{
+		{Label: Column(3)},
+		{ID: Column(5)},
+		{Columns: []int{0, 7}},
+	} {
+		if _, err := LoadCSV(strings.NewReader(input), options); !errors.As(err, &column) || column.Width != 3 {
+			t.Errorf("options %+v have error %v, want a column error for width 3", options, err)
+		}
+	}
+	if _, err := LoadCSV(strings.NewReader(input), LoadOptions{Label: Column(2), ID: Column(2)}); err == nil {
+		t.Error("the same label and id column has no error")
+	}
+	if _, err := LoadCSV(strings.NewReader(input), LoadOptions{Label: Column(0), ID: Column(1), Columns: []int{}}); err == nil {
+		t.Error("no feature columns has no error")
+	}
+
+	// the line of the bad value counts the header
+	var parse *ParseError
+	_, err := LoadCSV(strings.NewReader(input), LoadOptions{Label: Column(2)})
+	if !errors.As(err, &parse) || parse.Line != 4 || parse.Column != 1 || parse.Value != "oops" {
+		t.Errorf("got error %v, want a parse error of oops on line 4 column 1", err)
+	}
+	if _, err := LoadCSV(strings.NewReader(""), LoadOptions{}); !errors.Is(err, ErrEmpty) {
+		t.Errorf("empty input has error %v, want %v", err, ErrEmpty)
+	}
+	if _, err := LoadCSV(strings.NewReader("a,b\n"), LoadOptions{}); !errors.Is(err, ErrEmpty) {
+		t.Errorf("a header without rows has error %v, want %v", err, ErrEmpty)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Dataset {
+		return &Dataset{
+			Names:    []string{"a", "b"},
+			IDs:      []string{"r0", "r1", "r2"},
+			Features: [][]float64{{1, 2}, {3, 4}, {5, 6}},
+			Classes:  []string{"x", "y"},
+			Targets:  []int{0, 1, 0},
+		}
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Dataset{}).Validate(); !errors.Is(err, ErrEmpty) {
+		t.Errorf("no rows has error %v, want %v", err, ErrEmpty)
+	}
+	if err := (&Dataset{Features: [][]float64{{}, {}}}).Validate(); !errors.Is(err, ErrNoFeatures) {
+		t.Errorf("empty rows have error %v, want %v", err, ErrNoFeatures)
+	}
+
+	for _, test := range []struct {
+		name   string
+		modify func(d *Dataset)
+		shape  ShapeError
+	}{
+		{"ragged row", func(d *Dataset) { d.Features[2] = []float64{5} }, ShapeError{What: "features", Row: 2, Got: 1, Want: 2}},
+		{"names", func(d *Dataset) { d.Names = d.Names[:1] }, ShapeError{What: "names", Row: -1, Got: 1, Want: 2}},
+		{"ids", func(d *Dataset) { d.IDs = append(d.IDs, "r3") }, ShapeError{What: "ids", Row: -1, Got: 4, Want: 3}},
+		{"labels", func(d *Dataset) { d.SetLabels([]string{"x", "y"}) }, ShapeError{What: "targets", Row: -1, Got: 2, Want: 3}},
+	} {
+		data := valid()
+		test.modify(data)
+		var shape *ShapeError
+		if err := data.Validate(); !errors.As(err, &shape) || *shape != test.shape {
+			t.Errorf("%s: error %v, want %v", test.name, err, &test.shape)
+		}
+	}
+
+	data := valid()
+	data.Targets[1] = 2
+	if err := data.Validate(); err == nil {
+		t.Error("a target without a class has no error")
+	}
+}
+
+func TestSetLabels(t *testing.T) {
+	data := &Dataset{Features: [][]float64{{1}, {2}, {3}, {4}}, Classes: []string{"old"}}
+	data.SetLabels([]string{"b", "a", "b", "c"})
+	if !reflect.DeepEqual(data.Classes, []string{"b", "a", "c"}) || !reflect.DeepEqual(data.Targets, []int{0, 1, 0, 2}) {
+		t.Errorf("classes %v targets %v, want the classes in order of appearance", data.Classes, data.Targets)
+	}
+	if err := data.Validate(); err != nil {
+		t.Error(err)
+	}
+	if data.Label(3) != "c" {
+		t.Errorf("label of row 3 is %q, want c", data.Label(3))
+	}
+}
+
+func TestShapeError(t *testing.T) {
+	for _, test := range []struct {
+		err  ShapeError
+		want string
+	}{
+		{ShapeError{What: "features", Row: 2, Got: 1, Want: 4}, "features of row 2 has length 1, want 4"},
+		{ShapeError{What: "ids", Row: -1, Got: 3, Want: 5}, "ids has length 3, want 5"},
+	} {
+		if got := test.err.Error(); got != test.want {
+			t.Errorf("error %q, want %q", got, test.want)
+		}
+	}
+}
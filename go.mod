@@ -2,4 +2,4 @@ module github.com/pointlander/ultra
 
 go 1.22.4
 
-require github.com/alixaxel/pagerank v0.0.0-20200105181019-900657b89dcb // indirect
+require github.com/alixaxel/pagerank v0.0.0-20200105181019-900657b89dcb
@@ -0,0 +1,329 @@
+package kmeans
+
+import (
+	"fmt"
+	"math"
+)
+
+// Algorithm is the K-Means iteration algorithm
+type Algorithm int
+
+const (
+	// Lloyd computes the distance from every observation to every mean each iteration
+	Lloyd Algorithm = iota
+	// Elkan skips distances with an upper bound and a lower bound for every mean
+	Elkan
+	// Hamerly skips distances with an upper bound and a single lower bound
+	Hamerly
+)
+
+// String is the name of the algorithm
+func (a Algorithm) String() string {
+	switch a {
+	case Lloyd:
+		return "lloyd"
+	case Elkan:
+		return "elkan"
+	case Hamerly:
+		return "hamerly"
+	}
+	return fmt.Sprintf("Algorithm(%d)", int(a))
+}
+
+// ParseAlgorithm looks up an algorithm by name, the empty name is lloyd
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch name {
+	case "lloyd", "":
+		return Lloyd, nil
+	case "elkan":
+		return Elkan, nil
+	case "hamerly":
+		return Hamerly, nil
+	}
+	return 0, fmt.Errorf("unknown algorithm %q", name)
+}
+
+// Assigns observations to their closest means
+type assigner interface {
+	// Assign every observation to its closest mean, returns the number of changes
+	// previous are the means of the last call, reset discards any bounds
+	assign(data []ClusteredObservation, mean, previous []Observation, reset bool) (int, error)
+}
+
+// Create the assigner of an algorithm
+func newAssigner(algorithm Algorithm, distanceFunction DistanceFunction, isSquared bool, workers int) (assigner, error) {
+	switch algorithm {
+	case Lloyd:
+		return lloyd{distanceFunction: distanceFunction, workers: workers}, nil
+	case Elkan:
+		return &elkan{distanceFunction: metric(distanceFunction, isSquared), workers: workers}, nil
+	case Hamerly:
+		return &hamerly{distanceFunction: metric(distanceFunction, isSquared), workers: workers}, nil
+	}
+	return nil, fmt.Errorf("unknown algorithm %d", int(algorithm))
+}
+
+// The metric for the triangle inequality bounds
+// A squared distance isn't a metric, its square root orders observations the same way
+func metric(distanceFunction DistanceFunction, isSquared bool) DistanceFunction {
+	if !isSquared {
+		return distanceFunction
+	}
+	return func(firstVector, secondVector []float64) (float64, error) {
+		distance, err := distanceFunction(firstVector, secondVector)
+		return math.Sqrt(distance), err
+	}
+}
+
+// rounding is the relative error allowed in a distance, the bounds are loosened by it so that
+// rounding never skips a mean at the same distance as the assigned mean
+const rounding = 1e-9
+
+// An upper bound after its mean moved
+func raise(upper, moved float64) float64 {
+	return (upper + moved) * (1 + rounding)
+}
+
+// A lower bound after its means moved
+func drop(lower, moved float64) float64 {
+	if math.IsInf(lower, 1) {
+		return lower
+	}
+	return lower - moved - rounding*(lower+moved)
+}
+
+// Distances between every pair of means and half the distance from each mean to its closest other mean
+// Both are loosened by the rounding
+func separation(mean []Observation, distanceFunction DistanceFunction) ([][]float64, []float64, error) {
+	between, half := make([][]float64, len(mean)), make([]float64, len(mean))
+	for ii := range between {
+		between[ii] = make([]float64, len(mean))
+	}
+	for ii := range mean {
+		for jj := ii + 1; jj < len(mean); jj++ {
+			distance, err := distanceFunction(mean[ii], mean[jj])
+			if err != nil {
+				return nil, nil, err
+			}
+			distance *= 1 - rounding
+			between[ii][jj], between[jj][ii] = distance, distance
+		}
+	}
+	for ii := range mean {
+		half[ii] = math.Inf(1)
+		for jj := range mean {
+			if jj != ii && between[ii][jj]/2 < half[ii] {
+				half[ii] = between[ii][jj] / 2
+			}
+		}
+	}
+	return between, half, nil
+}
+
+// How far each mean moved since the last iteration
+func movement(mean, previous []Observation, distanceFunction DistanceFunction) ([]float64, error) {
+	moved := make([]float64, len(mean))
+	for ii := range mean {
+		distance, err := distanceFunction(mean[ii], previous[ii])
+		if err != nil {
+			return nil, err
+		}
+		moved[ii] = distance
+	}
+	return moved, nil
+}
+
+// Lloyd assignment computes every distance
+type lloyd struct {
+	distanceFunction DistanceFunction
+	workers          int
+}
+
+func (l lloyd) assign(data []ClusteredObservation, mean, previous []Observation, reset bool) (int, error) {
+	return each(len(data), l.workers, func(ii int) (bool, error) {
+		closestCluster, _, err := near(data[ii], mean, l.distanceFunction)
+		if err != nil || closestCluster == data[ii].ClusterNumber {
+			return false, err
+		}
+		data[ii].ClusterNumber = closestCluster
+		return true, nil
+	})
+}
+
+// Elkan assignment keeps an upper bound on the distance to the assigned mean and a lower bound for every mean
+type elkan struct {
+	distanceFunction DistanceFunction
+	workers          int
+	upper            []float64
+	lower            [][]float64
+}
+
+func (e *elkan) assign(data []ClusteredObservation, mean, previous []Observation, reset bool) (int, error) {
+	if reset || e.upper == nil {
+		e.upper, e.lower = make([]float64, len(data)), make([][]float64, len(data))
+		return each(len(data), e.workers, func(ii int) (bool, error) {
+			p := data[ii]
+			e.lower[ii] = make([]float64, len(mean))
+			closest := 0
+			for jj := range mean {
+				distance, err := e.distanceFunction(p.Observation, mean[jj])
+				if err != nil {
+					return false, err
+				}
+				e.lower[ii][jj] = distance
+				if distance < e.lower[ii][closest] {
+					closest = jj
+				}
+			}
+			e.upper[ii] = e.lower[ii][closest]
+			if closest == p.ClusterNumber {
+				return false, nil
+			}
+			data[ii].ClusterNumber = closest
+			return true, nil
+		})
+	}
+
+	moved, err := movement(mean, previous, e.distanceFunction)
+	if err != nil {
+		return 0, err
+	}
+	between, half, err := separation(mean, e.distanceFunction)
+	if err != nil {
+		return 0, err
+	}
+	return each(len(data), e.workers, func(ii int) (bool, error) {
+		p := data[ii]
+		closest := p.ClusterNumber
+		e.upper[ii] = raise(e.upper[ii], moved[closest])
+		for jj := range mean {
+			e.lower[ii][jj] = math.Max(0, drop(e.lower[ii][jj], moved[jj]))
+		}
+		// the skips are strict so a mean at the same distance is computed and ties go to the lowest index like Lloyd
+		if e.upper[ii] < half[closest] {
+			return false, nil
+		}
+		tight := false
+		for jj := range mean {
+			if jj == closest || e.upper[ii] < e.lower[ii][jj] || e.upper[ii] < between[closest][jj]/2 {
+				continue
+			}
+			if !tight {
+				distance, err := e.distanceFunction(p.Observation, mean[closest])
+				if err != nil {
+					return false, err
+				}
+				e.upper[ii], e.lower[ii][closest], tight = distance, distance, true
+				if e.upper[ii] < e.lower[ii][jj] || e.upper[ii] < between[closest][jj]/2 {
+					continue
+				}
+			}
+			distance, err := e.distanceFunction(p.Observation, mean[jj])
+			if err != nil {
+				return false, err
+			}
+			e.lower[ii][jj] = distance
+			if distance < e.upper[ii] || (distance == e.upper[ii] && jj < closest) {
+				closest, e.upper[ii] = jj, distance
+			}
+		}
+		if closest == p.ClusterNumber {
+			return false, nil
+		}
+		data[ii].ClusterNumber = closest
+		return true, nil
+	})
+}
+
+// Hamerly assignment keeps an upper bound on the distance to the assigned mean and one lower bound for the other means
+type hamerly struct {
+	distanceFunction DistanceFunction
+	workers          int
+	upper            []float64
+	lower            []float64
+}
+
+// Find the closest and second closest means of an observation
+func (h *hamerly) nearest(p ClusteredObservation, mean []Observation) (int, float64, float64, error) {
+	closest, first, second := 0, math.Inf(1), math.Inf(1)
+	for jj := range mean {
+		distance, err := h.distanceFunction(p.Observation, mean[jj])
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if distance < first {
+			closest, first, second = jj, distance, first
+		} else if distance < second {
+			second = distance
+		}
+	}
+	return closest, first, second, nil
+}
+
+func (h *hamerly) assign(data []ClusteredObservation, mean, previous []Observation, reset bool) (int, error) {
+	if reset || h.upper == nil {
+		h.upper, h.lower = make([]float64, len(data)), make([]float64, len(data))
+		return each(len(data), h.workers, func(ii int) (bool, error) {
+			closest, first, second, err := h.nearest(data[ii], mean)
+			if err != nil {
+				return false, err
+			}
+			h.upper[ii], h.lower[ii] = first, second
+			if closest == data[ii].ClusterNumber {
+				return false, nil
+			}
+			data[ii].ClusterNumber = closest
+			return true, nil
+		})
+	}
+
+	moved, err := movement(mean, previous, h.distanceFunction)
+	if err != nil {
+		return 0, err
+	}
+	_, half, err := separation(mean, h.distanceFunction)
+	if err != nil {
+		return 0, err
+	}
+	// the largest and second largest movement bound the movement of the other means
+	largest, secondLargest := 0, -1
+	for jj := 1; jj < len(moved); jj++ {
+		if moved[jj] > moved[largest] {
+			largest, secondLargest = jj, largest
+		} else if secondLargest < 0 || moved[jj] > moved[secondLargest] {
+			secondLargest = jj
+		}
+	}
+	return each(len(data), h.workers, func(ii int) (bool, error) {
+		p := data[ii]
+		closest := p.ClusterNumber
+		h.upper[ii] = raise(h.upper[ii], moved[closest])
+		if closest == largest && secondLargest >= 0 {
+			h.lower[ii] = drop(h.lower[ii], moved[secondLargest])
+		} else {
+			h.lower[ii] = drop(h.lower[ii], moved[largest])
+		}
+		// the skips are strict so ties go to the lowest index like Lloyd
+		bound := math.Max(half[closest], h.lower[ii])
+		if h.upper[ii] < bound {
+			return false, nil
+		}
+		distance, err := h.distanceFunction(p.Observation, mean[closest])
+		if err != nil {
+			return false, err
+		}
+		h.upper[ii] = distance
+		if h.upper[ii] < bound {
+			return false, nil
+		}
+		closest, h.upper[ii], h.lower[ii], err = h.nearest(p, mean)
+		if err != nil {
+			return false, err
+		}
+		if closest == p.ClusterNumber {
+			return false, nil
+		}
+		data[ii].ClusterNumber = closest
+		return true, nil
+	})
+}
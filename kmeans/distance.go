@@ -16,34 +16,65 @@ implemented separately.
 */
 
 import (
+	"errors"
+	"fmt"
 	"math"
 )
 
+var (
+	// ErrDimension means the vectors have different lengths
+	ErrDimension = errors.New("vectors have different lengths")
+	// ErrUndefined means the distance is NaN or divides by zero
+	ErrUndefined = errors.New("distance is undefined")
+)
+
+// Check that two vectors have the same length
+func dimensions(firstVector, secondVector []float64) error {
+	if len(firstVector) != len(secondVector) {
+		return fmt.Errorf("%w: %d and %d", ErrDimension, len(firstVector), len(secondVector))
+	}
+	return nil
+}
+
+// Check that a distance is defined
+func defined(distance float64) (float64, error) {
+	if math.IsNaN(distance) {
+		return 0, ErrUndefined
+	}
+	return distance, nil
+}
+
 // Lp Norm of an array, given p >= 1
 func LPNorm(vector []float64, p float64) (float64, error) {
 	distance := 0.
 	for _, jj := range vector {
 		distance += math.Pow(math.Abs(jj), p)
 	}
-	return math.Pow(distance, 1/p), nil
+	return defined(math.Pow(distance, 1/p))
 }
 
 // 1-norm distance (l_1 distance)
 func ManhattanDistance(firstVector, secondVector []float64) (float64, error) {
+	if err := dimensions(firstVector, secondVector); err != nil {
+		return 0, err
+	}
 	distance := 0.
 	for ii := range firstVector {
 		distance += math.Abs(firstVector[ii] - secondVector[ii])
 	}
-	return distance, nil
+	return defined(distance)
 }
 
 // 2-norm distance (l_2 distance)
 func EuclideanDistance(firstVector, secondVector []float64) (float64, error) {
+	if err := dimensions(firstVector, secondVector); err != nil {
+		return 0, err
+	}
 	distance := 0.
 	for ii := range firstVector {
 		distance += (firstVector[ii] - secondVector[ii]) * (firstVector[ii] - secondVector[ii])
 	}
-	return math.Sqrt(distance), nil
+	return defined(math.Sqrt(distance))
 }
 
 // Higher weight for the points that are far apart
@@ -55,56 +86,147 @@ func SquaredEuclideanDistance(firstVector, secondVector []float64) (float64, err
 
 // p-norm distance (l_p distance)
 func MinkowskiDistance(firstVector, secondVector []float64, p float64) (float64, error) {
+	if err := dimensions(firstVector, secondVector); err != nil {
+		return 0, err
+	}
 	distance := 0.
 	for ii := range firstVector {
 		distance += math.Pow(math.Abs(firstVector[ii]-secondVector[ii]), p)
 	}
-	return math.Pow(distance, 1/p), nil
+	return defined(math.Pow(distance, 1/p))
 }
 
 // p-norm distance with weights (weighted l_p distance)
 func WeightedMinkowskiDistance(firstVector, secondVector, weightVector []float64, p float64) (float64, error) {
+	if err := dimensions(firstVector, secondVector); err != nil {
+		return 0, err
+	}
+	if err := dimensions(firstVector, weightVector); err != nil {
+		return 0, err
+	}
 	distance := 0.
 	for ii := range firstVector {
 		distance += weightVector[ii] * math.Pow(math.Abs(firstVector[ii]-secondVector[ii]), p)
 	}
-	return math.Pow(distance, 1/p), nil
+	return defined(math.Pow(distance, 1/p))
 }
 
 // infinity norm distance (l_inf distance)
 func ChebyshevDistance(firstVector, secondVector []float64) (float64, error) {
+	if err := dimensions(firstVector, secondVector); err != nil {
+		return 0, err
+	}
 	distance := 0.
 	for ii := range firstVector {
-		if math.Abs(firstVector[ii]-secondVector[ii]) >= distance {
-			distance = math.Abs(firstVector[ii] - secondVector[ii])
+		if difference := math.Abs(firstVector[ii] - secondVector[ii]); math.IsNaN(difference) {
+			return 0, ErrUndefined
+		} else if difference >= distance {
+			distance = difference
 		}
 	}
 	return distance, nil
 }
 
+// Number of coordinates that differ
 func HammingDistance(firstVector, secondVector []float64) (float64, error) {
+	if err := dimensions(firstVector, secondVector); err != nil {
+		return 0, err
+	}
 	distance := 0.
 	for ii := range firstVector {
-		if firstVector[ii] != secondVector[ii] {
+		if math.IsNaN(firstVector[ii]) || math.IsNaN(secondVector[ii]) {
+			return 0, ErrUndefined
+		} else if firstVector[ii] != secondVector[ii] {
 			distance++
 		}
 	}
 	return distance, nil
 }
 
+// Sum of absolute differences over the absolute sum
+// Undefined when the vectors sum to zero
 func BrayCurtisDistance(firstVector, secondVector []float64) (float64, error) {
+	if err := dimensions(firstVector, secondVector); err != nil {
+		return 0, err
+	}
 	numerator, denominator := 0., 0.
 	for ii := range firstVector {
 		numerator += math.Abs(firstVector[ii] - secondVector[ii])
 		denominator += math.Abs(firstVector[ii] + secondVector[ii])
 	}
-	return numerator / denominator, nil
+	if denominator == 0 {
+		return 0, fmt.Errorf("%w: bray-curtis of vectors that sum to zero", ErrUndefined)
+	}
+	return defined(numerator / denominator)
 }
 
+// Sum of absolute differences over absolute sums of each coordinate
+// A coordinate that is zero in both vectors adds nothing, as in scipy
 func CanberraDistance(firstVector, secondVector []float64) (float64, error) {
+	if err := dimensions(firstVector, secondVector); err != nil {
+		return 0, err
+	}
 	distance := 0.
 	for ii := range firstVector {
-		distance += (math.Abs(firstVector[ii]-secondVector[ii]) / (math.Abs(firstVector[ii]) + math.Abs(secondVector[ii])))
+		denominator := math.Abs(firstVector[ii]) + math.Abs(secondVector[ii])
+		if denominator == 0 {
+			continue
+		}
+		distance += math.Abs(firstVector[ii]-secondVector[ii]) / denominator
 	}
-	return distance, nil
+	return defined(distance)
+}
+
+// One minus the cosine of the angle between the vectors
+// Undefined for zero vectors
+func CosineDistance(firstVector, secondVector []float64) (float64, error) {
+	if err := dimensions(firstVector, secondVector); err != nil {
+		return 0, err
+	}
+	dot, first, second := 0., 0., 0.
+	for ii := range firstVector {
+		dot += firstVector[ii] * secondVector[ii]
+		first += firstVector[ii] * firstVector[ii]
+		second += secondVector[ii] * secondVector[ii]
+	}
+	if first == 0 || second == 0 {
+		return 0, fmt.Errorf("%w: cosine of a zero vector", ErrUndefined)
+	}
+	return defined(1 - dot/math.Sqrt(first*second))
+}
+
+// One minus the Pearson correlation of the vectors
+// Undefined for constant vectors
+func CorrelationDistance(firstVector, secondVector []float64) (float64, error) {
+	if err := dimensions(firstVector, secondVector); err != nil {
+		return 0, err
+	}
+	firstMean, secondMean := 0., 0.
+	for ii := range firstVector {
+		firstMean += firstVector[ii]
+		secondMean += secondVector[ii]
+	}
+	firstMean /= float64(len(firstVector))
+	secondMean /= float64(len(secondVector))
+	covariance, first, second := 0., 0., 0.
+	for ii := range firstVector {
+		a, b := firstVector[ii]-firstMean, secondVector[ii]-secondMean
+		covariance += a * b
+		first += a * a
+		second += b * b
+	}
+	if first == 0 || second == 0 {
+		return 0, fmt.Errorf("%w: correlation of a constant vector", ErrUndefined)
+	}
+	return defined(1 - covariance/math.Sqrt(first*second))
+}
+
+// Minkowski distance of order p as a distance function, given p >= 1
+func Minkowski(p float64) (DistanceFunction, error) {
+	if !(p >= 1) || math.IsInf(p, 1) {
+		return nil, fmt.Errorf("minkowski order %v is not a finite number >= 1", p)
+	}
+	return func(firstVector, secondVector []float64) (float64, error) {
+		return MinkowskiDistance(firstVector, secondVector, p)
+	}, nil
 }
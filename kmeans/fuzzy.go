@@ -0,0 +1,180 @@
+package kmeans
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// DefaultFuzzifier is the default fuzzifier of fuzzy c-means
+const DefaultFuzzifier = 2
+
+// FuzzyOptions for fuzzy c-means
+type FuzzyOptions struct {
+	// Seed of the k-means++ seeding
+	Seed int64
+	// Fuzzifier is how soft the memberships are, it must be greater than 1 and defaults to DefaultFuzzifier
+	Fuzzifier float64
+	// MaxIter is the iteration limit, defaults to DefaultMaxIter
+	MaxIter int
+	// Tolerance is the largest change in a membership of a converged iteration, defaults to DefaultTolerance
+	Tolerance float64
+	// Workers is the number of goroutines of the seeding and membership steps, defaults to GOMAXPROCS
+	Workers int
+	// Squared is true if the distance is the square of a metric, the memberships then use it without squaring
+	Squared bool
+}
+
+// FuzzyResult is the result of fuzzy c-means
+type FuzzyResult struct {
+	// Memberships are the membership of each observation in each cluster, each row sums to one
+	Memberships [][]float64
+	// Labels are the cluster with the highest membership of each observation
+	Labels []int
+	// Centroids are the membership weighted cluster means
+	Centroids []Observation
+	// Objective is the sum of the memberships raised to the fuzzifier times the squared distances
+	Objective float64
+	// Iterations is the number of update steps run
+	Iterations int
+	// Converged is true if the memberships changed less than the tolerance in the last step
+	Converged bool
+}
+
+// Model of the result using the named distance function
+func (r FuzzyResult) Model(distance string) (*Model, error) {
+	return NewModel(r.Centroids, distance)
+}
+
+// Memberships of an observation given its distances to the centroids
+// The distances are squared unless they are already squared, an observation on a centroid belongs to it alone
+func memberships(distances []float64, isSquared bool, fuzzifier float64) []float64 {
+	u := make([]float64, len(distances))
+	zeros := 0
+	for _, distance := range distances {
+		if distance == 0 {
+			zeros++
+		}
+	}
+	if zeros > 0 {
+		for ii, distance := range distances {
+			if distance == 0 {
+				u[ii] = 1 / float64(zeros)
+			}
+		}
+		return u
+	}
+	exponent := 1 / (fuzzifier - 1)
+	for ii, distance := range distances {
+		d2 := weight(distance, isSquared)
+		sum := 0.0
+		for _, other := range distances {
+			sum += math.Pow(d2/weight(other, isSquared), exponent)
+		}
+		u[ii] = 1 / sum
+	}
+	return u
+}
+
+// FuzzyCMeans clusters the data into k fuzzy clusters
+func FuzzyCMeans(rawData [][]float64, k int, distanceFunction DistanceFunction, options FuzzyOptions) (FuzzyResult, error) {
+	if len(rawData) == 0 {
+		return FuzzyResult{}, errors.New("no data")
+	}
+	if k < 1 || k > len(rawData) {
+		return FuzzyResult{}, errors.New("k is out of range")
+	}
+	if options.Fuzzifier == 0 {
+		options.Fuzzifier = DefaultFuzzifier
+	}
+	if !(options.Fuzzifier > 1) {
+		return FuzzyResult{}, fmt.Errorf("fuzzifier %v is not greater than 1", options.Fuzzifier)
+	}
+	if options.MaxIter <= 0 {
+		options.MaxIter = DefaultMaxIter
+	}
+	if options.Tolerance <= 0 {
+		options.Tolerance = DefaultTolerance
+	}
+	data := make([]ClusteredObservation, len(rawData))
+	for ii, jj := range rawData {
+		data[ii].Observation = jj
+	}
+	rng := rand.New(rand.NewSource(options.Seed))
+	mean, err := seed(rng, data, k, distanceFunction, options.Squared, options.Workers)
+	if err != nil {
+		return FuzzyResult{}, err
+	}
+	isSquared := options.Squared
+	result := FuzzyResult{Memberships: make([][]float64, len(data))}
+	distances := make([][]float64, len(data))
+	for ii := range distances {
+		distances[ii] = make([]float64, k)
+	}
+	for n := len(data[0].Observation); ; {
+		// the largest membership change of each observation
+		changes := make([]float64, len(data))
+		_, err := each(len(data), options.Workers, func(ii int) (bool, error) {
+			for jj := range mean {
+				distance, err := distanceFunction(data[ii].Observation, mean[jj])
+				if err != nil {
+					return false, err
+				}
+				distances[ii][jj] = distance
+			}
+			u := memberships(distances[ii], isSquared, options.Fuzzifier)
+			for jj, previous := range result.Memberships[ii] {
+				changes[ii] = math.Max(changes[ii], math.Abs(u[jj]-previous))
+			}
+			if result.Memberships[ii] == nil {
+				changes[ii] = math.Inf(1)
+			}
+			result.Memberships[ii] = u
+			return false, nil
+		})
+		if err != nil {
+			return FuzzyResult{}, err
+		}
+		change := 0.0
+		for _, c := range changes {
+			change = math.Max(change, c)
+		}
+		if change < options.Tolerance {
+			result.Converged = true
+			break
+		}
+		if result.Iterations == options.MaxIter {
+			break
+		}
+		result.Iterations++
+		// each centroid is summed in observation order by one goroutine
+		parallel(k, 1, options.Workers, func(chunk, start, end int) {
+			for jj := start; jj < end; jj++ {
+				sum, total := make(Observation, n), 0.0
+				for ii, p := range data {
+					w := math.Pow(result.Memberships[ii][jj], options.Fuzzifier)
+					for kk, value := range p.Observation {
+						sum[kk] += w * value
+					}
+					total += w
+				}
+				if total > 0 {
+					sum.Mul(1 / total)
+					mean[jj] = sum
+				}
+			}
+		})
+	}
+
+	result.Labels, result.Centroids = make([]int, len(data)), mean
+	for ii, u := range result.Memberships {
+		for jj, membership := range u {
+			if membership > u[result.Labels[ii]] {
+				result.Labels[ii] = jj
+			}
+			result.Objective += math.Pow(membership, options.Fuzzifier) * weight(distances[ii][jj], isSquared)
+		}
+	}
+	return result, nil
+}
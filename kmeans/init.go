@@ -0,0 +1,174 @@
+package kmeans
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+const (
+	// DefaultOversampling is the default number of candidates sampled per round by kmeans|| as a multiple of k
+	DefaultOversampling = 2
+	// DefaultRounds is the default number of kmeans|| sampling rounds
+	DefaultRounds = 5
+)
+
+// Init is the method that picks the initial means
+type Init int
+
+const (
+	// InitKmeansPlusPlus picks each mean with probability proportional to the squared distance to the closest picked mean
+	InitKmeansPlusPlus Init = iota
+	// InitRandom picks k distinct observations uniformly
+	InitRandom
+	// InitParallel is kmeans||, it oversamples candidates in a few rounds and reduces them to k with weighted k-means++
+	InitParallel
+)
+
+// String is the name of the init method
+func (i Init) String() string {
+	switch i {
+	case InitKmeansPlusPlus:
+		return "kmeans++"
+	case InitRandom:
+		return "random"
+	case InitParallel:
+		return "kmeans||"
+	}
+	return fmt.Sprintf("Init(%d)", int(i))
+}
+
+// ParseInit looks up an init method by name, the empty name is kmeans++
+func ParseInit(name string) (Init, error) {
+	switch name {
+	case "kmeans++", "":
+		return InitKmeansPlusPlus, nil
+	case "random":
+		return InitRandom, nil
+	case "kmeans||", "parallel":
+		return InitParallel, nil
+	}
+	return 0, fmt.Errorf("unknown init %q", name)
+}
+
+// Pick the initial means with the init method of the options
+func initialize(rng *rand.Rand, data []ClusteredObservation, k int, distanceFunction DistanceFunction, options Options) ([]Observation, error) {
+	switch options.Init {
+	case InitKmeansPlusPlus:
+		return seed(rng, data, k, distanceFunction, options.Squared, options.Parallelism)
+	case InitRandom:
+		s := make([]Observation, k)
+		for ii, jj := range rng.Perm(len(data))[:k] {
+			s[ii] = data[jj].Observation
+		}
+		return s, nil
+	case InitParallel:
+		return parallelSeed(rng, data, k, distanceFunction, options.Squared, options.Oversampling, options.Rounds, options.Parallelism)
+	}
+	return nil, fmt.Errorf("unknown init %d", int(options.Init))
+}
+
+// kmeans|| seeding of Bahmani et al.
+// Each round samples every observation independently with probability oversampling*k*d²/ψ
+// The distances are computed in parallel, the sampling and sums are in order
+func parallelSeed(rng *rand.Rand, data []ClusteredObservation, k int, distanceFunction DistanceFunction, isSquared bool, oversampling float64, rounds, workers int) ([]Observation, error) {
+	if oversampling <= 0 {
+		oversampling = DefaultOversampling
+	}
+	if rounds <= 0 {
+		rounds = DefaultRounds
+	}
+	candidates := []Observation{data[rng.Intn(len(data))].Observation}
+	d2 := make([]float64, len(data))
+	for jj := range d2 {
+		d2[jj] = math.Inf(1)
+	}
+	// update lowers the squared distances with the new candidates and returns ψ
+	update := func(added []Observation) (float64, error) {
+		_, err := each(len(data), workers, func(jj int) (bool, error) {
+			_, dMin, err := near(data[jj], added, distanceFunction)
+			if d := weight(dMin, isSquared); d < d2[jj] {
+				d2[jj] = d
+			}
+			return false, err
+		})
+		var psi float64
+		for _, d := range d2 {
+			psi += d
+		}
+		return psi, err
+	}
+	psi, err := update(candidates)
+	if err != nil {
+		return nil, err
+	}
+	l := oversampling * float64(k)
+	for round := 0; round < rounds && psi > 0; round++ {
+		picked := len(candidates)
+		for jj := range data {
+			if rng.Float64()*psi < l*d2[jj] {
+				candidates = append(candidates, data[jj].Observation)
+			}
+		}
+		if added := candidates[picked:]; len(added) > 0 {
+			if psi, err = update(added); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// weight each candidate by the number of observations closest to it
+	closest := make([]int, len(data))
+	_, err = each(len(data), workers, func(jj int) (bool, error) {
+		cluster, _, err := near(data[jj], candidates, distanceFunction)
+		closest[jj] = cluster
+		return false, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	weights := make([]float64, len(candidates))
+	for _, c := range closest {
+		weights[c]++
+	}
+	return weightedSeed(rng, candidates, weights, k, distanceFunction, isSquared)
+}
+
+// Weighted k-means++ seeding, candidates are picked with probability proportional to weight times squared distance
+// Candidates are reused when there are fewer than k
+func weightedSeed(rng *rand.Rand, candidates []Observation, weights []float64, k int, distanceFunction DistanceFunction, isSquared bool) ([]Observation, error) {
+	s := make([]Observation, k)
+	var total float64
+	for _, weight := range weights {
+		total += weight
+	}
+	target := rng.Float64() * total
+	first := 0
+	for sum := weights[0]; sum < target && first < len(candidates)-1; sum += weights[first] {
+		first++
+	}
+	s[0] = candidates[first]
+	d2 := make([]float64, len(candidates))
+	for ii := 1; ii < k; ii++ {
+		var sum float64
+		for jj, candidate := range candidates {
+			_, dMin, err := near(ClusteredObservation{Observation: candidate}, s[:ii], distanceFunction)
+			if err != nil {
+				return nil, err
+			}
+			d2[jj] = weights[jj] * weight(dMin, isSquared)
+			sum += d2[jj]
+		}
+		if sum == 0 {
+			s[ii] = candidates[rng.Intn(len(candidates))]
+			continue
+		}
+		target := rng.Float64() * sum
+		jj := 0
+		for sum = d2[0]; sum < target && jj < len(candidates)-1; sum += d2[jj] {
+			jj++
+		}
+		s[ii] = candidates[jj]
+	}
+	return s, nil
+}
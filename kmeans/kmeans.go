@@ -1,8 +1,11 @@
 package kmeans
 
 import (
+	"errors"
+	"fmt"
 	"math"
 	"math/rand"
+	"runtime"
 )
 
 // Observation: Data Abstraction for an N-dimensional
@@ -33,6 +36,18 @@ func (observation Observation) Mul(scalar float64) {
 	}
 }
 
+// Scale a vector to unit length, returns the length before scaling
+func (observation Observation) unit() float64 {
+	norm := 0.
+	for _, value := range observation {
+		norm += value * value
+	}
+	if norm = math.Sqrt(norm); norm > 0 {
+		observation.Mul(1 / norm)
+	}
+	return norm
+}
+
 // Dot Product of Two vectors
 func (observation Observation) InnerProduct(otherObservation Observation) {
 	for ii := range observation {
@@ -57,31 +72,45 @@ func (observation Observation) OuterProduct(otherObservation Observation) [][]fl
 
 // Find the closest observation and return the distance
 // Index of observation, distance
-func near(p ClusteredObservation, mean []Observation, distanceFunction DistanceFunction) (int, float64) {
+func near(p ClusteredObservation, mean []Observation, distanceFunction DistanceFunction) (int, float64, error) {
 	indexOfCluster := 0
-	minSquaredDistance, _ := distanceFunction(p.Observation, mean[0])
+	minDistance, err := distanceFunction(p.Observation, mean[0])
+	if err != nil {
+		return 0, 0, err
+	}
 	for i := 1; i < len(mean); i++ {
-		squaredDistance, _ := distanceFunction(p.Observation, mean[i])
-		if squaredDistance < minSquaredDistance {
-			minSquaredDistance = squaredDistance
+		distance, err := distanceFunction(p.Observation, mean[i])
+		if err != nil {
+			return 0, 0, err
+		}
+		if distance < minDistance {
+			minDistance = distance
 			indexOfCluster = i
 		}
 	}
-	return indexOfCluster, math.Sqrt(minSquaredDistance)
+	return indexOfCluster, minDistance, nil
 }
 
 // Instead of initializing randomly the seeds, make a sound decision of initializing
-func seed(rng *rand.Rand, data []ClusteredObservation, k int, distanceFunction DistanceFunction) []Observation {
+// Observations are picked with probability proportional to the squared distance to the closest seed
+// The distances are computed in parallel and summed in order
+func seed(rng *rand.Rand, data []ClusteredObservation, k int, distanceFunction DistanceFunction, isSquared bool, workers int) ([]Observation, error) {
 	s := make([]Observation, k)
 	first := rng.Intn(len(data))
 	s[0] = data[first].Observation
 	d2 := make([]float64, len(data))
 	for ii := 1; ii < k; ii++ {
+		_, err := each(len(data), workers, func(jj int) (bool, error) {
+			_, dMin, err := near(data[jj], s[:ii], distanceFunction)
+			d2[jj] = weight(dMin, isSquared)
+			return false, err
+		})
+		if err != nil {
+			return nil, err
+		}
 		var sum float64
-		for jj, p := range data {
-			_, dMin := near(p, s[:ii], distanceFunction)
-			d2[jj] = dMin * dMin
-			sum += d2[jj]
+		for _, d := range d2 {
+			sum += d
 		}
 		target := rng.Float64() * sum
 		jj := 0
@@ -90,57 +119,407 @@ func seed(rng *rand.Rand, data []ClusteredObservation, k int, distanceFunction D
 		}
 		s[ii] = data[jj].Observation
 	}
-	return s
+	return s, nil
+}
+
+const (
+	// DefaultMaxIter is the default iteration limit
+	DefaultMaxIter = 300
+	// DefaultTolerance is the default relative centroid shift of a converged iteration
+	DefaultTolerance = 1e-4
+)
+
+// Stop is why the K-Means iteration stopped
+type Stop int
+
+const (
+	// StopStable means no observation changed cluster
+	StopStable Stop = iota
+	// StopTolerance means the centroids moved less than the tolerance
+	StopTolerance
+	// StopMaxIter means the iteration limit was reached
+	StopMaxIter
+	// StopEnd means the source of observations ran out
+	StopEnd
+	// StopNoImprovement means the smoothed inertia of the mini-batches stopped improving
+	StopNoImprovement
+)
+
+// String is the name of the stop reason
+func (s Stop) String() string {
+	switch s {
+	case StopStable:
+		return "stable"
+	case StopTolerance:
+		return "tolerance"
+	case StopMaxIter:
+		return "max iterations"
+	case StopEnd:
+		return "end of source"
+	case StopNoImprovement:
+		return "no improvement"
+	}
+	return fmt.Sprintf("Stop(%d)", int(s))
+}
+
+// Result of the K-Means Algorithm
+type Result struct {
+	// Labels are the cluster of each observation
+	Labels []int
+	// Centroids are the final cluster means
+	Centroids []Observation
+	// Sizes are the number of observations in each cluster
+	Sizes []int
+	// Inertia is the sum of squared euclidean distances to the centroids
+	Inertia float64
+	// Iterations is the number of update steps run
+	Iterations int
+	// Converged is true if iteration stopped before the iteration limit
+	Converged bool
+	// Stop is why iteration stopped
+	Stop Stop
+	// Seed is the seed of the run
+	Seed int64
+	// Inertias are the inertias of every restart when the result is from Fit
+	Inertias []float64
+	// Covariances are the covariance of each cluster when the result is from FitMahalanobis
+	Covariances [][][]float64
+}
+
+// EmptyCluster is the strategy for a cluster that loses all of its observations
+type EmptyCluster int
+
+const (
+	// EmptyReseed moves the observation farthest from its mean into the empty cluster
+	EmptyReseed EmptyCluster = iota
+	// EmptySplit splits the largest cluster in two around its farthest observation
+	EmptySplit
+	// EmptyError stops with ErrEmptyCluster
+	EmptyError
+)
+
+// ErrEmptyCluster means a cluster lost all of its observations
+var ErrEmptyCluster = errors.New("empty cluster")
+
+// Find the observation farthest from its mean in clusters with more than one observation
+// Only observations in cluster only are considered unless only is negative
+// Returns -1 if every observation considered is on its mean
+func farthest(data []ClusteredObservation, mean []Observation, mLen []int, only int, distanceFunction DistanceFunction) (int, error) {
+	index, max := -1, 0.0
+	for ii, p := range data {
+		if mLen[p.ClusterNumber] < 2 || (only >= 0 && p.ClusterNumber != only) {
+			continue
+		}
+		distance, err := distanceFunction(p.Observation, mean[p.ClusterNumber])
+		if err != nil {
+			return 0, err
+		}
+		if distance > max {
+			index, max = ii, distance
+		}
+	}
+	return index, nil
+}
+
+// Recompute the mean of a cluster from its observations
+func update(data []ClusteredObservation, mean []Observation, mLen []int, cluster int) {
+	mean[cluster] = make(Observation, len(data[0].Observation))
+	mLen[cluster] = 0
+	for _, p := range data {
+		if p.ClusterNumber == cluster {
+			mean[cluster].Add(p.Observation)
+			mLen[cluster]++
+		}
+	}
+	mean[cluster].Mul(1 / float64(mLen[cluster]))
+}
+
+// Fill an empty cluster with the strategy
+// The empty cluster keeps its mean if every observation that could move is on its mean
+func fill(data []ClusteredObservation, mean []Observation, mLen []int, empty int, strategy EmptyCluster, distanceFunction DistanceFunction) error {
+	switch strategy {
+	case EmptyReseed:
+		index, err := farthest(data, mean, mLen, -1, distanceFunction)
+		if err != nil || index < 0 {
+			return err
+		}
+		donor := data[index].ClusterNumber
+		data[index].ClusterNumber = empty
+		update(data, mean, mLen, donor)
+		update(data, mean, mLen, empty)
+	case EmptySplit:
+		largest := 0
+		for ii := range mLen {
+			if mLen[ii] > mLen[largest] {
+				largest = ii
+			}
+		}
+		index, err := farthest(data, mean, mLen, largest, distanceFunction)
+		if err != nil || index < 0 {
+			return err
+		}
+		center := data[index].Observation
+		moved := 0
+		for ii, p := range data {
+			if p.ClusterNumber != largest || moved == mLen[largest]-1 {
+				continue
+			}
+			toCenter, err := distanceFunction(p.Observation, center)
+			if err != nil {
+				return err
+			}
+			toMean, err := distanceFunction(p.Observation, mean[largest])
+			if err != nil {
+				return err
+			}
+			if ii == index || toCenter < toMean {
+				data[ii].ClusterNumber = empty
+				moved++
+			}
+		}
+		update(data, mean, mLen, largest)
+		update(data, mean, mLen, empty)
+	default:
+		return fmt.Errorf("%w %d", ErrEmptyCluster, empty)
+	}
+	return nil
 }
 
 // K-Means Algorithm
-func kmeans(data []ClusteredObservation, mean []Observation, distanceFunction DistanceFunction, threshold int) ([]ClusteredObservation, error) {
+// Returns the number of iterations and why iteration stopped
+func kmeans(data []ClusteredObservation, mean []Observation, distanceFunction DistanceFunction, options Options) (int, Stop, error) {
+	maxIter, tolerance := options.MaxIter, options.Tolerance
+	if maxIter <= 0 {
+		maxIter = DefaultMaxIter
+	}
+	if tolerance == 0 {
+		tolerance = DefaultTolerance
+	}
+	tolerance *= variance(data)
+	assigner, err := newAssigner(options.Algorithm, distanceFunction, options.Squared, options.Parallelism)
+	if err != nil {
+		return 0, StopMaxIter, err
+	}
 	counter := 0
-	for ii, jj := range data {
-		closestCluster, _ := near(jj, mean, distanceFunction)
-		data[ii].ClusterNumber = closestCluster
+	if _, err := assigner.assign(data, mean, nil, true); err != nil {
+		return 0, StopMaxIter, err
 	}
 	mLen := make([]int, len(mean))
-	for n := len(data[0].Observation); ; {
+	previous := make([]Observation, len(mean))
+	for n := len(data[0].Observation); counter < maxIter; {
+		copy(previous, mean)
+		// each cluster is summed in observation order by one goroutine
+		members := make([][]int, len(mean))
+		for ii, p := range data {
+			members[p.ClusterNumber] = append(members[p.ClusterNumber], ii)
+		}
+		parallel(len(mean), 1, options.Parallelism, func(chunk, start, end int) {
+			for ii := start; ii < end; ii++ {
+				mean[ii] = make(Observation, n)
+				for _, jj := range members[ii] {
+					mean[ii].Add(data[jj].Observation)
+				}
+				mLen[ii] = len(members[ii])
+				if mLen[ii] > 0 {
+					mean[ii].Mul(1 / float64(mLen[ii]))
+				}
+			}
+		})
+		filled := false
 		for ii := range mean {
-			mean[ii] = make(Observation, n)
-			mLen[ii] = 0
+			if mLen[ii] == 0 {
+				filled = true
+				mean[ii] = append(Observation(nil), previous[ii]...)
+				if err := fill(data, mean, mLen, ii, options.EmptyCluster, distanceFunction); err != nil {
+					return counter, StopMaxIter, err
+				}
+			}
 		}
-		for _, p := range data {
-			mean[p.ClusterNumber].Add(p.Observation)
-			mLen[p.ClusterNumber]++
+		if options.Spherical {
+			for ii := range mean {
+				mean[ii].unit()
+			}
 		}
+		shift := 0.0
 		for ii := range mean {
-			mean[ii].Mul(1 / float64(mLen[ii]))
-		}
-		var changes int
-		for ii, p := range data {
-			if closestCluster, _ := near(p, mean, distanceFunction); closestCluster != p.ClusterNumber {
-				changes++
-				data[ii].ClusterNumber = closestCluster
+			for jj, value := range mean[ii] {
+				diff := value - previous[ii][jj]
+				shift += diff * diff
 			}
 		}
+		changes, err := assigner.assign(data, mean, previous, filled)
+		if err != nil {
+			return counter, StopMaxIter, err
+		}
 		counter++
-		if changes == 0 || counter > threshold {
-			return data, nil
+		switch {
+		case changes == 0:
+			return counter, StopStable, nil
+		case shift <= tolerance:
+			return counter, StopTolerance, nil
+		}
+	}
+	return counter, StopMaxIter, nil
+}
+
+// The mean variance of the features of the data
+func variance(data []ClusteredObservation) float64 {
+	n := len(data[0].Observation)
+	mean, sum := make(Observation, n), 0.0
+	for _, p := range data {
+		mean.Add(p.Observation)
+	}
+	mean.Mul(1 / float64(len(data)))
+	for _, p := range data {
+		for jj, value := range p.Observation {
+			diff := value - mean[jj]
+			sum += diff * diff
 		}
 	}
-	return data, nil
+	return sum / float64(len(data)*n)
+}
+
+// Summarize the clustered data into a result
+func summarize(data []ClusteredObservation, mean []Observation) Result {
+	result := Result{
+		Labels:    make([]int, len(data)),
+		Centroids: mean,
+		Sizes:     make([]int, len(mean)),
+	}
+	for ii, p := range data {
+		result.Labels[ii] = p.ClusterNumber
+		result.Sizes[p.ClusterNumber]++
+		for jj, value := range p.Observation {
+			diff := value - mean[p.ClusterNumber][jj]
+			result.Inertia += diff * diff
+		}
+	}
+	return result
 }
 
 // K-Means Algorithm with smart seeds
 // as known as K-Means ++
-func Kmeans(rngSeed int64, rawData [][]float64, k int, distanceFunction DistanceFunction, threshold int) ([]int, []Observation, error) {
+// Runs at most threshold+1 iterations, a negative threshold runs at most DefaultMaxIter
+// The distance is treated as a metric, use Fit with Options.Squared for a squared distance
+func Kmeans(rngSeed int64, rawData [][]float64, k int, distanceFunction DistanceFunction, threshold int) (Result, error) {
+	if len(rawData) == 0 {
+		return Result{}, errors.New("no data")
+	}
+	if k < 1 || k > len(rawData) {
+		return Result{}, errors.New("k is out of range")
+	}
+	return run(rngSeed, rawData, k, distanceFunction, Options{MaxIter: threshold + 1})
+}
+
+// Run K-Means ++ once with the options
+func run(rngSeed int64, rawData [][]float64, k int, distanceFunction DistanceFunction, options Options) (Result, error) {
 	rng := rand.New(rand.NewSource(rngSeed))
 	data := make([]ClusteredObservation, len(rawData))
 	for ii, jj := range rawData {
 		data[ii].Observation = jj
+		if options.Spherical {
+			data[ii].Observation = append(Observation(nil), jj...)
+			if data[ii].unit() == 0 {
+				return Result{}, fmt.Errorf("%w: spherical k-means of zero observation %d", ErrUndefined, ii)
+			}
+		}
+	}
+	mean, err := initialize(rng, data, k, distanceFunction, options)
+	if err != nil {
+		return Result{}, err
+	}
+	iterations, stop, err := kmeans(data, mean, distanceFunction, options)
+	if err != nil {
+		return Result{}, err
+	}
+	result := summarize(data, mean)
+	result.Iterations, result.Stop, result.Seed = iterations, stop, rngSeed
+	result.Converged = stop != StopMaxIter
+	return result, nil
+}
+
+// Options for the K-Means Algorithm with restarts
+type Options struct {
+	// Seed is the seed of the first restart, restart i uses Seed+i
+	Seed int64
+	// Restarts is the number of runs, defaults to 1
+	Restarts int
+	// MaxIter is the iteration limit of each run, defaults to DefaultMaxIter
+	MaxIter int
+	// Tolerance is the total squared centroid shift of a converged iteration relative to the mean feature variance
+	// Defaults to DefaultTolerance, negative only stops when no observation changes cluster
+	Tolerance float64
+	// Workers is the number of restarts run in parallel, defaults to the number of CPUs
+	Workers int
+	// EmptyCluster is the strategy for clusters that lose all of their observations, defaults to EmptyReseed
+	EmptyCluster EmptyCluster
+	// Parallelism is the number of goroutines of the seeding, assignment and update steps of a run, defaults to GOMAXPROCS
+	// The result doesn't depend on it
+	Parallelism int
+	// Init is the method that picks the initial means, defaults to InitKmeansPlusPlus
+	Init Init
+	// Oversampling is the number of candidates kmeans|| samples per round as a multiple of k, defaults to DefaultOversampling
+	Oversampling float64
+	// Rounds is the number of kmeans|| sampling rounds, defaults to DefaultRounds
+	Rounds int
+	// Spherical clusters the observations scaled to unit length and keeps the centroids unit length
+	// It is meant for cosine distance, the inertia is of the scaled observations
+	Spherical bool
+	// Algorithm is the iteration algorithm, defaults to Lloyd
+	// Elkan and Hamerly need a metric distance or a squared distance with Squared set
+	Algorithm Algorithm
+	// Squared is true if the distance is the square of a metric such as SquaredEuclideanDistance,
+	// see Squared for the registered distances, k-means++ then weights by the distance instead of its square
+	Squared bool
+}
+
+// K-Means ++ restarted with different seeds in parallel
+// Returns the run with the lowest inertia, ties go to the earliest restart
+func Fit(rawData [][]float64, k int, distanceFunction DistanceFunction, options Options) (Result, error) {
+	if len(rawData) == 0 {
+		return Result{}, errors.New("no data")
+	}
+	if k < 1 || k > len(rawData) {
+		return Result{}, errors.New("k is out of range")
+	}
+	if options.Restarts < 1 {
+		options.Restarts = 1
 	}
-	seeds := seed(rng, data, k, distanceFunction)
-	clusteredData, err := kmeans(data, seeds, distanceFunction, threshold)
-	labels := make([]int, len(clusteredData))
-	for ii, jj := range clusteredData {
-		labels[ii] = jj.ClusterNumber
+	if options.Workers < 1 {
+		options.Workers = runtime.NumCPU()
+	}
+	results := make([]Result, options.Restarts)
+	errs := make([]error, options.Restarts)
+	done := make(chan bool, options.Workers)
+	restart := func(ii int) {
+		results[ii], errs[ii] = run(options.Seed+int64(ii), rawData, k, distanceFunction, options)
+		done <- true
+	}
+	flight, index := 0, 0
+	for ; index < len(results); index++ {
+		if flight == options.Workers {
+			<-done
+			flight--
+		}
+		go restart(index)
+		flight++
+	}
+	for ; flight > 0; flight-- {
+		<-done
+	}
+
+	best := 0
+	inertias := make([]float64, len(results))
+	for ii, result := range results {
+		if errs[ii] != nil {
+			return Result{}, errs[ii]
+		}
+		inertias[ii] = result.Inertia
+		if result.Inertia < results[best].Inertia {
+			best = ii
+		}
 	}
-	return labels, seeds, err
+	result := results[best]
+	result.Inertias = inertias
+	return result, nil
 }
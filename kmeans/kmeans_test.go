@@ -0,0 +1,612 @@
+package kmeans
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Observations with two seeds on the same point, which leaves the second cluster empty after the first assignment
+//
+// The first cluster gets the four observations near the origin and its mean is (2.75, 0.25), {6, 0} is the farthest from it.
+// Reseeding moves {6, 0} to the empty cluster and {5, 0} follows on the next assignment,
+// splitting moves {6, 0} and {5, 0} which is closer to {6, 0} than to the mean at once.
+func crafted() ([]ClusteredObservation, []Observation) {
+	rawData := [][]float64{{0, 0}, {0, 1}, {5, 0}, {6, 0}, {20, 20}, {21, 20}}
+	data := make([]ClusteredObservation, len(rawData))
+	for ii, jj := range rawData {
+		data[ii].Observation = jj
+	}
+	return data, []Observation{{0, 0}, {0, 0}, {20, 20}}
+}
+
+// Fewer distinct observations than clusters leave a cluster empty, which had a NaN mean before the empty cluster strategies
+func TestEmptyClusterNaN(t *testing.T) {
+	rawData := [][]float64{{0, 0}, {0, 0}, {0, 0}, {0, 0}, {5, 5}, {5, 5}, {6, 6}}
+	for seed := int64(1); seed <= 5; seed++ {
+		result, err := Kmeans(seed, rawData, 4, EuclideanDistance, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.IsNaN(result.Inertia) {
+			t.Fatalf("seed %d: inertia is NaN", seed)
+		}
+		for ii, centroid := range result.Centroids {
+			for _, value := range centroid {
+				if math.IsNaN(value) {
+					t.Fatalf("seed %d: centroid %d is %v", seed, ii, centroid)
+				}
+			}
+		}
+	}
+	for _, k := range []int{0, len(rawData) + 1} {
+		if _, err := Kmeans(1, rawData, k, EuclideanDistance, 10); err == nil {
+			t.Errorf("k=%d has no error", k)
+		}
+	}
+
+	// every observation is on its mean so no strategy can fill the empty cluster, it keeps its mean
+	for _, strategy := range []EmptyCluster{EmptyReseed, EmptySplit} {
+		data := []ClusteredObservation{{Observation: Observation{0, 0}}, {Observation: Observation{0, 0}}, {Observation: Observation{5, 5}}}
+		mean := []Observation{{0, 0}, {1, 1}, {5, 5}}
+		if _, _, err := kmeans(data, mean, EuclideanDistance, Options{MaxIter: 10, EmptyCluster: strategy}); err != nil {
+			t.Fatalf("strategy %d: %v", strategy, err)
+		}
+		if mean[1][0] != 1 || mean[1][1] != 1 {
+			t.Errorf("strategy %d: the empty cluster moved to %v, want it to stay at [1 1]", strategy, mean[1])
+		}
+	}
+}
+
+func TestEmptyCluster(t *testing.T) {
+	want := []Observation{{0, 0.5}, {5.5, 0}, {20.5, 20}}
+	for _, test := range []struct {
+		strategy   EmptyCluster
+		iterations int
+	}{
+		{EmptyReseed, 2},
+		{EmptySplit, 1},
+	} {
+		data, mean := crafted()
+		iterations, stop, err := kmeans(data, mean, SquaredEuclideanDistance, Options{MaxIter: 10, EmptyCluster: test.strategy})
+		if err != nil {
+			t.Fatalf("strategy %d: %v", test.strategy, err)
+		}
+		if iterations != test.iterations || stop != StopStable {
+			t.Errorf("strategy %d: stopped %v after %d iterations, want %v after %d", test.strategy, stop, iterations, StopStable, test.iterations)
+		}
+		for ii := range want {
+			for jj := range want[ii] {
+				if mean[ii][jj] != want[ii][jj] {
+					t.Fatalf("strategy %d: means are %v, want %v", test.strategy, mean, want)
+				}
+			}
+		}
+		result := summarize(data, mean)
+		if sizes := []int{2, 2, 2}; result.Sizes[0] != sizes[0] || result.Sizes[1] != sizes[1] || result.Sizes[2] != sizes[2] {
+			t.Errorf("strategy %d: sizes are %v, want %v", test.strategy, result.Sizes, sizes)
+		}
+	}
+
+	data, mean := crafted()
+	if _, _, err := kmeans(data, mean, SquaredEuclideanDistance, Options{MaxIter: 10, EmptyCluster: EmptyError}); !errors.Is(err, ErrEmptyCluster) {
+		t.Fatalf("got error %v, want %v", err, ErrEmptyCluster)
+	}
+}
+
+// Observations on a line at uneven spacing so D and D² weighting give different distributions
+func line() []ClusteredObservation {
+	data := make([]ClusteredObservation, 0, 4)
+	for _, x := range []float64{0, 1, 3, 7} {
+		data = append(data, ClusteredObservation{Observation: Observation{x}})
+	}
+	return data
+}
+
+// The expected probability of each pair of first and second seeds with D² weighting
+func expected(data []ClusteredObservation) [][]float64 {
+	probabilities := make([][]float64, len(data))
+	for ii := range data {
+		probabilities[ii] = make([]float64, len(data))
+		sum := 0.0
+		for jj := range data {
+			diff := data[ii].Observation[0] - data[jj].Observation[0]
+			probabilities[ii][jj] = diff * diff
+			sum += diff * diff
+		}
+		for jj := range data {
+			probabilities[ii][jj] /= sum * float64(len(data))
+		}
+	}
+	return probabilities
+}
+
+func TestSeedDistribution(t *testing.T) {
+	const trials = 40000
+	data := line()
+	want := expected(data)
+	index := map[float64]int{0: 0, 1: 1, 3: 2, 7: 3}
+	for _, name := range []string{"sqeuclidean", "euclidean", "manhattan", "chebyshev", "minkowski-3"} {
+		distanceFunction, err := Lookup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, initialization := range []Init{InitKmeansPlusPlus, InitParallel} {
+			rng := rand.New(rand.NewSource(1))
+			counts := make([][]float64, len(data))
+			for ii := range counts {
+				counts[ii] = make([]float64, len(data))
+			}
+			for trial := 0; trial < trials; trial++ {
+				var s []Observation
+				if initialization == InitKmeansPlusPlus {
+					s, err = seed(rng, data, 2, distanceFunction, Squared(name), 1)
+				} else {
+					// the kmeans|| reduction with unit weights is k-means++ on the candidates
+					candidates, weights := make([]Observation, len(data)), make([]float64, len(data))
+					for ii, p := range data {
+						candidates[ii], weights[ii] = p.Observation, 1
+					}
+					s, err = weightedSeed(rng, candidates, weights, 2, distanceFunction, Squared(name))
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				counts[index[s[0][0]]][index[s[1][0]]]++
+			}
+			for ii := range counts {
+				for jj := range counts[ii] {
+					if got := counts[ii][jj] / trials; math.Abs(got-want[ii][jj]) > 0.01 {
+						t.Errorf("%s %s: seeds %d then %d with probability %.4f, want %.4f", name, initialization, ii, jj, got, want[ii][jj])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSquared(t *testing.T) {
+	if !Squared("sqeuclidean") || Squared("euclidean") {
+		t.Fatal("only sqeuclidean should be squared")
+	}
+	for _, distance := range []float64{0, 0.5, 2} {
+		if weight(distance*distance, true) != weight(distance, false) {
+			t.Fatalf("weights of %f differ", distance)
+		}
+	}
+	a, b := []float64{0, 0}, []float64{3, 4}
+	if distance, _ := metric(SquaredEuclideanDistance, true)(a, b); distance != 5 {
+		t.Fatalf("the metric of the squared distance is %f, want 5", distance)
+	}
+	if distance, _ := metric(EuclideanDistance, false)(a, b); distance != 5 {
+		t.Fatalf("the metric of the distance is %f, want 5", distance)
+	}
+}
+
+// Elkan and Hamerly give the labels of Lloyd on small integers, which have many ties in distance
+func TestAccelerated(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 300; trial++ {
+		data := make([][]float64, 20+rng.Intn(100))
+		width := 1 + rng.Intn(3)
+		for ii := range data {
+			data[ii] = make([]float64, width)
+			for jj := range data[ii] {
+				data[ii][jj] = float64(rng.Intn(6))
+			}
+		}
+		k, seed := 2+rng.Intn(5), rng.Int63()
+		for _, distance := range []string{"euclidean", "sqeuclidean", "manhattan"} {
+			distanceFunction, err := Lookup(distance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			options := Options{Seed: seed, Workers: 1, Squared: Squared(distance)}
+			lloyd, err := Fit(data, k, distanceFunction, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, algorithm := range []Algorithm{Elkan, Hamerly} {
+				options.Algorithm = algorithm
+				result, err := Fit(data, k, distanceFunction, options)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for ii, label := range lloyd.Labels {
+					if result.Labels[ii] != label {
+						t.Fatalf("trial %d %s k=%d %s: observation %d is in cluster %d, lloyd has %d",
+							trial, distance, k, algorithm, ii, result.Labels[ii], label)
+					}
+				}
+				for ii, centroid := range lloyd.Centroids {
+					for jj, value := range centroid {
+						if result.Centroids[ii][jj] != value {
+							t.Fatalf("trial %d %s k=%d %s: centroid %d is %v, lloyd has %v",
+								trial, distance, k, algorithm, ii, result.Centroids[ii], centroid)
+						}
+					}
+				}
+				if result.Iterations != lloyd.Iterations {
+					t.Errorf("trial %d %s k=%d %s: %d iterations, lloyd has %d",
+						trial, distance, k, algorithm, result.Iterations, lloyd.Iterations)
+				}
+			}
+		}
+	}
+}
+
+// The inertia of the data with each observation assigned to its closest centroid
+func inertia(t *testing.T, data [][]float64, centroids []Observation) float64 {
+	t.Helper()
+	sum := 0.0
+	for _, observation := range data {
+		_, distance, err := near(ClusteredObservation{Observation: observation}, centroids, SquaredEuclideanDistance)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum += distance
+	}
+	return sum
+}
+
+func TestMiniBatch(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := make([][]float64, 4000)
+	for ii := range data {
+		center := float64(ii % 4 * 10)
+		data[ii] = []float64{center + rng.NormFloat64(), rng.NormFloat64() - center}
+	}
+	fit, err := Fit(data, 4, SquaredEuclideanDistance, Options{Seed: 1, Restarts: 5, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := inertia(t, data, fit.Centroids)
+	for seed := int64(1); seed <= 5; seed++ {
+		source := NewSliceSource(data)
+		result, err := MiniBatch(source, 4, SquaredEuclideanDistance, MiniBatchOptions{Seed: seed, BatchSize: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the means are seeded from the first three mini-batches of the pass
+		if !result.Converged || (result.Iterations+3)*100 < len(data) {
+			t.Errorf("seed %d: stopped %v after %d mini-batches, want convergence after a pass", seed, result.Stop, result.Iterations)
+		}
+		if got := inertia(t, data, result.Centroids); got > want*1.005 {
+			t.Errorf("seed %d: inertia %f, want within 0.5%% of %f", seed, got, want)
+		}
+	}
+}
+
+// Results don't depend on the number of goroutines, the data spans several chunks
+func TestParallelism(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := make([][]float64, 5*ChunkSize+7)
+	for ii := range data {
+		center := float64(ii % 5 * 3)
+		data[ii] = []float64{center + rng.NormFloat64(), rng.NormFloat64(), center - rng.NormFloat64()}
+	}
+	for _, algorithm := range []Algorithm{Lloyd, Elkan, Hamerly} {
+		for _, initialization := range []Init{InitKmeansPlusPlus, InitParallel} {
+			var want Result
+			for _, workers := range []int{1, 2, 7} {
+				options := Options{Seed: 1, Restarts: 3, Workers: workers, Parallelism: workers, Algorithm: algorithm, Init: initialization}
+				result, err := Fit(data, 5, SquaredEuclideanDistance, options)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if workers == 1 {
+					want = result
+					continue
+				}
+				if result.Inertia != want.Inertia || result.Iterations != want.Iterations {
+					t.Errorf("%s %s workers=%d: inertia %v after %d iterations, want %v after %d",
+						algorithm, initialization, workers, result.Inertia, result.Iterations, want.Inertia, want.Iterations)
+				}
+				for ii, centroid := range want.Centroids {
+					for jj, value := range centroid {
+						if result.Centroids[ii][jj] != value {
+							t.Fatalf("%s %s workers=%d: centroid %d is %v, want %v", algorithm, initialization, workers, ii, result.Centroids[ii], centroid)
+						}
+					}
+				}
+				for ii, label := range want.Labels {
+					if result.Labels[ii] != label {
+						t.Fatalf("%s %s workers=%d: observation %d is in cluster %d, want %d", algorithm, initialization, workers, ii, result.Labels[ii], label)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestCorrelation(t *testing.T) {
+	if _, err := CorrelationDistance([]float64{1, 2, 3}, []float64{2, 2, 2}); !errors.Is(err, ErrUndefined) {
+		t.Fatalf("correlation with a constant vector has error %v, want %v", err, ErrUndefined)
+	}
+	for _, test := range []struct {
+		second   []float64
+		distance float64
+	}{
+		{[]float64{2, 4, 6}, 0},
+		{[]float64{3, 2, 1}, 2},
+	} {
+		distance, err := CorrelationDistance([]float64{1, 2, 3}, test.second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(distance-test.distance) > 1e-12 {
+			t.Errorf("correlation distance to %v is %f, want %f", test.second, distance, test.distance)
+		}
+	}
+}
+
+func TestCanberraHamming(t *testing.T) {
+	for _, test := range []struct {
+		first, second []float64
+		distance      float64
+	}{
+		// coordinates that are zero in both vectors add nothing
+		{[]float64{0, 1, 0}, []float64{0, 3, 0}, 0.5},
+		{[]float64{0, 0}, []float64{0, 0}, 0},
+		{[]float64{1, -1}, []float64{-1, 1}, 2},
+	} {
+		distance, err := CanberraDistance(test.first, test.second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(distance-test.distance) > 1e-12 {
+			t.Errorf("canberra distance of %v and %v is %f, want %f", test.first, test.second, distance, test.distance)
+		}
+	}
+
+	if distance, err := HammingDistance([]float64{1, 2, 3}, []float64{1, 0, 4}); err != nil || distance != 2 {
+		t.Errorf("hamming distance is %f with error %v, want 2", distance, err)
+	}
+	for _, distance := range []DistanceFunction{HammingDistance, CanberraDistance} {
+		if _, err := distance([]float64{1, math.NaN()}, []float64{1, 2}); !errors.Is(err, ErrUndefined) {
+			t.Errorf("a NaN coordinate has error %v, want %v", err, ErrUndefined)
+		}
+	}
+}
+
+func TestMahalanobisIdentity(t *testing.T) {
+	distanceFunction, err := Mahalanobis([][]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	for ii := 0; ii < 100; ii++ {
+		a := []float64{rng.NormFloat64(), rng.NormFloat64(), rng.NormFloat64()}
+		b := []float64{rng.NormFloat64(), rng.NormFloat64(), rng.NormFloat64()}
+		got, err := distanceFunction(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := EuclideanDistance(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(got-want) > 1e-12 {
+			t.Fatalf("mahalanobis distance with the identity is %f, euclidean is %f", got, want)
+		}
+	}
+}
+
+func TestSpherical(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := make([][]float64, 200)
+	for ii := range data {
+		scale := 1 + 10*rng.Float64()
+		direction := float64(ii % 3)
+		data[ii] = []float64{scale * (direction + rng.Float64()), scale * (3 - direction), scale * rng.Float64()}
+	}
+	result, err := Fit(data, 3, CosineDistance, Options{Seed: 1, Restarts: 3, Workers: 1, Spherical: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ii, centroid := range result.Centroids {
+		norm := 0.0
+		for _, value := range centroid {
+			norm += value * value
+		}
+		if math.Abs(math.Sqrt(norm)-1) > 1e-12 {
+			t.Errorf("centroid %d has norm %f, want 1", ii, math.Sqrt(norm))
+		}
+	}
+}
+
+// A long thin cluster beside a compact one, which a shared covariance splits across
+func TestFitMahalanobis(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data, truth := make([][]float64, 300), make([]int, 300)
+	for ii := range data {
+		truth[ii] = ii % 2
+		if truth[ii] == 0 {
+			data[ii] = []float64{20 * rng.NormFloat64(), 0.5 * rng.NormFloat64()}
+		} else {
+			data[ii] = []float64{0.5 * rng.NormFloat64(), 4 + 0.5*rng.NormFloat64()}
+		}
+	}
+	result, err := FitMahalanobis(data, 2, Options{Seed: 1, Restarts: 5, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Stop != StopStable || len(result.Covariances) != 2 {
+		t.Fatalf("stopped %v with %d covariances, want stable with 2", result.Stop, len(result.Covariances))
+	}
+	if result.Labels[0] == result.Labels[1] {
+		t.Fatal("the clusters are merged")
+	}
+	for ii, label := range result.Labels {
+		if label != result.Labels[truth[ii]] {
+			t.Fatalf("observation %d of cluster %d is in cluster %d", ii, truth[ii], label)
+		}
+	}
+	model, err := result.Model(MahalanobisName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := model.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadModel(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels, err := loaded.PredictBatch(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ii, label := range result.Labels {
+		if labels[ii] != label {
+			t.Fatalf("the loaded model predicts cluster %d for observation %d, want %d", labels[ii], ii, label)
+		}
+	}
+}
+
+// Small blobs with an exhaustive search for the optimal medoids
+func TestMedoids(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := make([][]float64, 15)
+	for ii := range data {
+		center := float64(ii % 3 * 4)
+		data[ii] = []float64{center + rng.NormFloat64(), center/2 + rng.NormFloat64()}
+	}
+	distances, err := DistanceMatrix(data, EuclideanDistance, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	optimal := math.Inf(1)
+	for a := 0; a < len(data); a++ {
+		for b := a + 1; b < len(data); b++ {
+			for c := b + 1; c < len(data); c++ {
+				cost := 0.0
+				for _, row := range distances {
+					cost += math.Min(row[a], math.Min(row[b], row[c]))
+				}
+				optimal = math.Min(optimal, cost)
+			}
+		}
+	}
+	for _, algorithm := range []MedoidAlgorithm{MedoidPAM, MedoidFasterPAM} {
+		for seed := int64(1); seed <= 3; seed++ {
+			result, err := KMedoids(data, 3, EuclideanDistance, MedoidOptions{Seed: seed, Algorithm: algorithm, Workers: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(result.Cost-optimal) > 1e-9 {
+				t.Errorf("algorithm %d seed %d: cost %f, want %f", algorithm, seed, result.Cost, optimal)
+			}
+			cost := 0.0
+			for ii, label := range result.Labels {
+				medoid := result.Medoids[label]
+				if result.Labels[medoid] != label {
+					t.Fatalf("algorithm %d seed %d: medoid %d of cluster %d is in cluster %d", algorithm, seed, medoid, label, result.Labels[medoid])
+				}
+				distance, err := EuclideanDistance(data[ii], data[medoid])
+				if err != nil {
+					t.Fatal(err)
+				}
+				cost += distance
+			}
+			if math.Abs(cost-result.Cost) > 1e-9 {
+				t.Errorf("algorithm %d seed %d: the distances to the medoid rows cost %f, the result has %f", algorithm, seed, cost, result.Cost)
+			}
+		}
+	}
+}
+
+// CLARA is a sampling heuristic, ten samples of the default size come close to PAM on the whole data
+func TestCLARA(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := make([][]float64, 600)
+	for ii := range data {
+		center := float64(ii % 4 * 6)
+		data[ii] = []float64{center + rng.NormFloat64(), rng.NormFloat64() - center}
+	}
+	pam, err := KMedoids(data, 4, EuclideanDistance, MedoidOptions{Algorithm: MedoidPAM, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for seed := int64(1); seed <= 3; seed++ {
+		result, err := CLARA(data, 4, EuclideanDistance, MedoidOptions{Seed: seed, Workers: 1, Samples: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Cost > pam.Cost*1.05 {
+			t.Errorf("seed %d: clara cost %f, want within 5%% of pam %f", seed, result.Cost, pam.Cost)
+		}
+	}
+}
+
+func TestFuzzy(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := make([][]float64, 300)
+	for ii := range data {
+		center := float64(ii % 3 * 3)
+		data[ii] = []float64{center + rng.NormFloat64(), rng.NormFloat64() - center}
+	}
+	fit, err := Fit(data, 3, SquaredEuclideanDistance, Options{Seed: 1, Restarts: 5, Workers: 1, Squared: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fuzzifier := range []float64{2, 1.01} {
+		result, err := FuzzyCMeans(data, 3, SquaredEuclideanDistance, FuzzyOptions{Seed: 1, Fuzzifier: fuzzifier, Workers: 1, Squared: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for ii, u := range result.Memberships {
+			sum := 0.0
+			for _, membership := range u {
+				sum += membership
+			}
+			if math.Abs(sum-1) > 1e-12 {
+				t.Fatalf("fuzzifier %v: the memberships of observation %d sum to %f", fuzzifier, ii, sum)
+			}
+		}
+		if fuzzifier != 1.01 {
+			continue
+		}
+		// a fuzzifier near one is hard k-means, up to the names of the clusters
+		names := make(map[int]int)
+		for ii, label := range result.Labels {
+			if name, ok := names[label]; !ok {
+				names[label] = fit.Labels[ii]
+			} else if name != fit.Labels[ii] {
+				t.Fatalf("observation %d is in fuzzy cluster %d with the k-means cluster %d, want %d", ii, label, fit.Labels[ii], name)
+			}
+		}
+		named := make(map[int]bool)
+		for _, name := range names {
+			named[name] = true
+		}
+		if len(named) != 3 {
+			t.Fatalf("%d fuzzy clusters are %d k-means clusters, want 3", len(names), len(named))
+		}
+		for ii, u := range result.Memberships {
+			if u[result.Labels[ii]] < 0.99 {
+				t.Fatalf("observation %d has membership %f in its cluster, want nearly 1", ii, u[result.Labels[ii]])
+			}
+		}
+	}
+	model, err := fit.Model("sqeuclidean")
+	if err != nil {
+		t.Fatal(err)
+	}
+	memberships, err := model.MembershipsBatch(data, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ii, u := range memberships {
+		sum := 0.0
+		for _, membership := range u {
+			sum += membership
+		}
+		if math.Abs(sum-1) > 1e-12 {
+			t.Fatalf("the model memberships of observation %d sum to %f", ii, sum)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package kmeans
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrSingular means a covariance matrix can't be inverted
+var ErrSingular = errors.New("covariance matrix is singular")
+
+// Covariance of the columns of the data
+func Covariance(data [][]float64) ([][]float64, error) {
+	if len(data) < 2 {
+		return nil, errors.New("covariance needs at least two observations")
+	}
+	n := len(data[0])
+	mean := make(Observation, n)
+	for ii, observation := range data {
+		if err := dimensions(observation, data[0]); err != nil {
+			return nil, fmt.Errorf("observation %d: %w", ii, err)
+		}
+		mean.Add(observation)
+	}
+	mean.Mul(1 / float64(len(data)))
+	return scatter(data, mean, float64(len(data)-1)), nil
+}
+
+// Scatter matrix of the observations about the mean divided by the degrees of freedom
+func scatter(data [][]float64, mean Observation, freedom float64) [][]float64 {
+	n := len(mean)
+	covariance := make([][]float64, n)
+	for ii := range covariance {
+		covariance[ii] = make([]float64, n)
+	}
+	for _, observation := range data {
+		for ii := range covariance {
+			a := observation[ii] - mean[ii]
+			for jj := ii; jj < n; jj++ {
+				covariance[ii][jj] += a * (observation[jj] - mean[jj])
+			}
+		}
+	}
+	for ii := range covariance {
+		for jj := ii; jj < n; jj++ {
+			covariance[ii][jj] /= freedom
+			covariance[jj][ii] = covariance[ii][jj]
+		}
+	}
+	return covariance
+}
+
+// Invert a matrix with Gauss-Jordan elimination and partial pivoting
+func invert(matrix [][]float64) ([][]float64, error) {
+	n := len(matrix)
+	a, inverse := make([][]float64, n), make([][]float64, n)
+	scale := 0.0
+	for ii := range matrix {
+		if len(matrix[ii]) != n {
+			return nil, fmt.Errorf("%w: covariance row %d has length %d, want %d", ErrDimension, ii, len(matrix[ii]), n)
+		}
+		a[ii] = append([]float64(nil), matrix[ii]...)
+		inverse[ii] = make([]float64, n)
+		inverse[ii][ii] = 1
+		for _, value := range matrix[ii] {
+			scale = math.Max(scale, math.Abs(value))
+		}
+	}
+	for column := 0; column < n; column++ {
+		pivot := column
+		for row := column + 1; row < n; row++ {
+			if math.Abs(a[row][column]) > math.Abs(a[pivot][column]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][column]) <= 1e-12*scale {
+			return nil, ErrSingular
+		}
+		a[column], a[pivot] = a[pivot], a[column]
+		inverse[column], inverse[pivot] = inverse[pivot], inverse[column]
+		factor := 1 / a[column][column]
+		for jj := 0; jj < n; jj++ {
+			a[column][jj] *= factor
+			inverse[column][jj] *= factor
+		}
+		for row := 0; row < n; row++ {
+			if row == column || a[row][column] == 0 {
+				continue
+			}
+			factor := a[row][column]
+			for jj := 0; jj < n; jj++ {
+				a[row][jj] -= factor * a[column][jj]
+				inverse[row][jj] -= factor * inverse[column][jj]
+			}
+		}
+	}
+	return inverse, nil
+}
+
+// Mahalanobis distance with the covariance matrix
+func Mahalanobis(covariance [][]float64) (DistanceFunction, error) {
+	inverse, err := invert(covariance)
+	if err != nil {
+		return nil, err
+	}
+	return func(firstVector, secondVector []float64) (float64, error) {
+		if err := dimensions(firstVector, secondVector); err != nil {
+			return 0, err
+		}
+		if len(firstVector) != len(inverse) {
+			return 0, fmt.Errorf("%w: %d and covariance %d", ErrDimension, len(firstVector), len(inverse))
+		}
+		distance := 0.
+		for ii := range firstVector {
+			a := firstVector[ii] - secondVector[ii]
+			for jj := range secondVector {
+				distance += a * inverse[ii][jj] * (firstVector[jj] - secondVector[jj])
+			}
+		}
+		return defined(math.Sqrt(math.Max(0, distance)))
+	}, nil
+}
+
+// MahalanobisData is the Mahalanobis distance with the covariance estimated from the data
+func MahalanobisData(data [][]float64) (DistanceFunction, error) {
+	covariance, err := Covariance(data)
+	if err != nil {
+		return nil, err
+	}
+	return Mahalanobis(covariance)
+}
+
+// ClusterCovariances estimates the covariance of each of k clusters from its observations
+// Clusters with too few observations for a full covariance use the pooled within-cluster covariance
+func ClusterCovariances(data [][]float64, labels []int, k int) ([][][]float64, error) {
+	if len(labels) != len(data) {
+		return nil, fmt.Errorf("%d labels for %d observations", len(labels), len(data))
+	}
+	if len(data) <= k {
+		return nil, errors.New("pooled covariance needs more observations than clusters")
+	}
+	clusters := make([][][]float64, k)
+	for ii, label := range labels {
+		if label < 0 || label >= k {
+			return nil, fmt.Errorf("label %d of observation %d is out of range", label, ii)
+		}
+		if err := dimensions(data[ii], data[0]); err != nil {
+			return nil, fmt.Errorf("observation %d: %w", ii, err)
+		}
+		clusters[label] = append(clusters[label], data[ii])
+	}
+	n := len(data[0])
+	means := make([]Observation, k)
+	pooled := make([][]float64, n)
+	for ii := range pooled {
+		pooled[ii] = make([]float64, n)
+	}
+	for c, members := range clusters {
+		means[c] = make(Observation, n)
+		for _, observation := range members {
+			means[c].Add(observation)
+		}
+		if len(members) > 0 {
+			means[c].Mul(1 / float64(len(members)))
+		}
+		for ii, row := range scatter(members, means[c], float64(len(data)-k)) {
+			for jj, value := range row {
+				pooled[ii][jj] += value
+			}
+		}
+	}
+	covariances := make([][][]float64, k)
+	for c, members := range clusters {
+		covariances[c] = pooled
+		if len(members) > n {
+			covariances[c] = scatter(members, means[c], float64(len(members)-1))
+		}
+	}
+	return covariances, nil
+}
+
+// Mahalanobis distances with the covariances
+func mahalanobis(covariances [][][]float64) ([]DistanceFunction, error) {
+	distances := make([]DistanceFunction, len(covariances))
+	for c, covariance := range covariances {
+		distance, err := Mahalanobis(covariance)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %d: %w", c, err)
+		}
+		distances[c] = distance
+	}
+	return distances, nil
+}
+
+// FitMahalanobis clusters with a Mahalanobis distance for each cluster
+// It starts from Fit with the Mahalanobis distance of the data covariance, then alternates estimating the
+// covariance of each cluster and moving each observation to the centroid nearest by the distance of its cluster
+// The iterations and stop are of the alternation, the result has the covariance of each cluster
+func FitMahalanobis(rawData [][]float64, k int, options Options) (Result, error) {
+	distance, err := MahalanobisData(rawData)
+	if err != nil {
+		return Result{}, err
+	}
+	result, err := Fit(rawData, k, distance, options)
+	if err != nil {
+		return Result{}, err
+	}
+	maxIter := options.MaxIter
+	if maxIter <= 0 {
+		maxIter = DefaultMaxIter
+	}
+	data := make([]ClusteredObservation, len(rawData))
+	for ii, observation := range rawData {
+		data[ii] = ClusteredObservation{ClusterNumber: result.Labels[ii], Observation: observation}
+	}
+	labels, mean := result.Labels, result.Centroids
+	result.Iterations, result.Stop = 0, StopMaxIter
+	for {
+		result.Covariances, err = ClusterCovariances(rawData, labels, k)
+		if err != nil {
+			return Result{}, err
+		}
+		if result.Iterations == maxIter {
+			break
+		}
+		distances, err := mahalanobis(result.Covariances)
+		if err != nil {
+			return Result{}, err
+		}
+		changes := 0
+		for ii, p := range data {
+			cluster, minDistance := 0, math.Inf(1)
+			for c, distance := range distances {
+				d, err := distance(p.Observation, mean[c])
+				if err != nil {
+					return Result{}, err
+				}
+				if d < minDistance {
+					cluster, minDistance = c, d
+				}
+			}
+			if cluster != p.ClusterNumber {
+				data[ii].ClusterNumber = cluster
+				changes++
+			}
+		}
+		if changes == 0 {
+			result.Stop = StopStable
+			break
+		}
+		result.Iterations++
+		mean = centroids(data, mean)
+		labels = make([]int, len(data))
+		for ii, p := range data {
+			labels[ii] = p.ClusterNumber
+		}
+	}
+	summary := summarize(data, mean)
+	result.Labels, result.Centroids, result.Sizes, result.Inertia = summary.Labels, summary.Centroids, summary.Sizes, summary.Inertia
+	result.Converged = result.Stop != StopMaxIter
+	return result, nil
+}
+
+// The means of the clusters of the data, an empty cluster keeps its previous mean
+func centroids(data []ClusteredObservation, previous []Observation) []Observation {
+	mean, sizes := make([]Observation, len(previous)), make([]int, len(previous))
+	for ii := range mean {
+		mean[ii] = make(Observation, len(previous[ii]))
+	}
+	for _, p := range data {
+		mean[p.ClusterNumber].Add(p.Observation)
+		sizes[p.ClusterNumber]++
+	}
+	for ii := range mean {
+		if sizes[ii] == 0 {
+			copy(mean[ii], previous[ii])
+			continue
+		}
+		mean[ii].Mul(1 / float64(sizes[ii]))
+	}
+	return mean
+}
@@ -0,0 +1,401 @@
+package kmeans
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// DefaultClaraSamples is the default number of samples CLARA clusters
+const DefaultClaraSamples = 5
+
+// MedoidAlgorithm is the k-medoids algorithm
+type MedoidAlgorithm int
+
+const (
+	// MedoidFasterPAM starts from random medoids and eagerly takes the best swap for each candidate
+	MedoidFasterPAM MedoidAlgorithm = iota
+	// MedoidPAM is the BUILD and SWAP of Kaufman and Rousseeuw, it takes the best of all swaps each iteration
+	MedoidPAM
+)
+
+// MedoidOptions for k-medoids
+type MedoidOptions struct {
+	// Seed of the random number generator
+	Seed int64
+	// Algorithm is the k-medoids algorithm, also used for the CLARA samples, defaults to MedoidFasterPAM
+	Algorithm MedoidAlgorithm
+	// MaxIter is the limit on the swap iterations, passes over the observations for FasterPAM, defaults to DefaultMaxIter
+	MaxIter int
+	// Samples is the number of samples CLARA clusters, defaults to DefaultClaraSamples
+	Samples int
+	// SampleSize is the number of observations in each CLARA sample, defaults to 40+2k
+	SampleSize int
+	// Workers is the number of goroutines that compute distances, defaults to GOMAXPROCS
+	Workers int
+}
+
+// MedoidResult is the result of k-medoids
+type MedoidResult struct {
+	// Labels are the cluster of each observation
+	Labels []int
+	// Medoids are the index of the observation that is the medoid of each cluster
+	Medoids []int
+	// Sizes are the number of observations in each cluster
+	Sizes []int
+	// Cost is the sum of the distances from the observations to their medoids
+	Cost float64
+	// Swaps is the number of medoids that were swapped
+	Swaps int
+	// Converged is true if no swap improved the cost before the iteration limit
+	Converged bool
+}
+
+// DistanceMatrix computes the distances between every pair of observations
+func DistanceMatrix(data [][]float64, distanceFunction DistanceFunction, workers int) ([][]float64, error) {
+	distances := make([][]float64, len(data))
+	for ii := range distances {
+		distances[ii] = make([]float64, len(data))
+	}
+	_, err := each(len(data), workers, func(ii int) (bool, error) {
+		for jj := ii + 1; jj < len(data); jj++ {
+			distance, err := distanceFunction(data[ii], data[jj])
+			if err != nil {
+				return false, fmt.Errorf("observations %d and %d: %w", ii, jj, err)
+			}
+			// each goroutine only writes the upper triangle of its rows
+			distances[ii][jj] = distance
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for ii := range distances {
+		for jj := ii + 1; jj < len(distances); jj++ {
+			distances[jj][ii] = distances[ii][jj]
+		}
+	}
+	return distances, nil
+}
+
+// KMedoids clusters the data around k medoids with the distance function
+func KMedoids(data [][]float64, k int, distanceFunction DistanceFunction, options MedoidOptions) (MedoidResult, error) {
+	distances, err := DistanceMatrix(data, distanceFunction, options.Workers)
+	if err != nil {
+		return MedoidResult{}, err
+	}
+	return KMedoidsMatrix(distances, k, options)
+}
+
+// KMedoidsMatrix clusters observations around k medoids given the matrix of distances between them
+func KMedoidsMatrix(distances [][]float64, k int, options MedoidOptions) (MedoidResult, error) {
+	if len(distances) == 0 {
+		return MedoidResult{}, errors.New("no data")
+	}
+	if k < 1 || k > len(distances) {
+		return MedoidResult{}, errors.New("k is out of range")
+	}
+	for ii, row := range distances {
+		if len(row) != len(distances) {
+			return MedoidResult{}, fmt.Errorf("%w: distance row %d has length %d, want %d", ErrDimension, ii, len(row), len(distances))
+		}
+	}
+	if options.MaxIter <= 0 {
+		options.MaxIter = DefaultMaxIter
+	}
+	var medoids []int
+	var swaps int
+	var converged bool
+	switch {
+	case k == 1:
+		// the first medoid of BUILD is the optimal single medoid
+		medoids, converged = build(distances, k), true
+	case options.Algorithm == MedoidFasterPAM:
+		rng := rand.New(rand.NewSource(options.Seed))
+		medoids = rng.Perm(len(distances))[:k]
+		swaps, converged = fasterPAM(distances, medoids, options.MaxIter)
+	case options.Algorithm == MedoidPAM:
+		medoids = build(distances, k)
+		swaps, converged = swap(distances, medoids, options.MaxIter)
+	default:
+		return MedoidResult{}, fmt.Errorf("unknown medoid algorithm %d", int(options.Algorithm))
+	}
+	result := label(len(distances), medoids, func(ii, jj int) (float64, error) {
+		return distances[ii][jj], nil
+	})
+	result.Swaps, result.Converged = swaps, converged
+	return result, nil
+}
+
+// Assign each of n observations to its closest medoid
+func label(n int, medoids []int, distance func(ii, jj int) (float64, error)) MedoidResult {
+	result := MedoidResult{
+		Labels:  make([]int, n),
+		Medoids: medoids,
+		Sizes:   make([]int, len(medoids)),
+	}
+	for ii := 0; ii < n; ii++ {
+		best, min := 0, math.Inf(1)
+		for c, medoid := range medoids {
+			if d, _ := distance(ii, medoid); d < min {
+				best, min = c, d
+			}
+		}
+		result.Labels[ii] = best
+		result.Sizes[best]++
+		result.Cost += min
+	}
+	return result
+}
+
+// The closest and second closest medoid of each observation and their distances
+type nearest struct {
+	closest, second   []int
+	dClosest, dSecond []float64
+}
+
+// Find the closest and second closest medoids of every observation
+func newNearest(distances [][]float64, medoids []int) *nearest {
+	n := len(distances)
+	near := &nearest{
+		closest:  make([]int, n),
+		second:   make([]int, n),
+		dClosest: make([]float64, n),
+		dSecond:  make([]float64, n),
+	}
+	for jj := range distances {
+		near.update(distances, medoids, jj)
+	}
+	return near
+}
+
+// Update the closest medoids of observation jj
+func (n *nearest) update(distances [][]float64, medoids []int, jj int) {
+	n.closest[jj], n.second[jj] = -1, -1
+	n.dClosest[jj], n.dSecond[jj] = math.Inf(1), math.Inf(1)
+	for c, medoid := range medoids {
+		d := distances[jj][medoid]
+		if d < n.dClosest[jj] {
+			n.second[jj], n.dSecond[jj] = n.closest[jj], n.dClosest[jj]
+			n.closest[jj], n.dClosest[jj] = c, d
+		} else if d < n.dSecond[jj] {
+			n.second[jj], n.dSecond[jj] = c, d
+		}
+	}
+}
+
+// PAM BUILD greedily adds the medoid that lowers the cost the most
+func build(distances [][]float64, k int) []int {
+	n := len(distances)
+	medoids := make([]int, 0, k)
+	closest := make([]float64, n)
+	for jj := range closest {
+		closest[jj] = math.Inf(1)
+	}
+	isMedoid := make([]bool, n)
+	for len(medoids) < k {
+		best, bestGain := -1, math.Inf(-1)
+		for ii := 0; ii < n; ii++ {
+			if isMedoid[ii] {
+				continue
+			}
+			gain := 0.0
+			for jj := 0; jj < n; jj++ {
+				if math.IsInf(closest[jj], 1) {
+					gain -= distances[ii][jj]
+				} else if d := distances[ii][jj]; d < closest[jj] {
+					gain += closest[jj] - d
+				}
+			}
+			if gain > bestGain {
+				best, bestGain = ii, gain
+			}
+		}
+		medoids = append(medoids, best)
+		isMedoid[best] = true
+		for jj := range closest {
+			closest[jj] = math.Min(closest[jj], distances[best][jj])
+		}
+	}
+	return medoids
+}
+
+// PAM SWAP makes the swap of a medoid and an observation that lowers the cost the most until no swap helps
+func swap(distances [][]float64, medoids []int, maxIter int) (int, bool) {
+	n := len(distances)
+	isMedoid := make([]bool, n)
+	for _, medoid := range medoids {
+		isMedoid[medoid] = true
+	}
+	near := newNearest(distances, medoids)
+	swaps := 0
+	for iteration := 0; iteration < maxIter; iteration++ {
+		bestMedoid, bestCandidate, bestChange := -1, -1, 0.0
+		for c := range medoids {
+			for candidate := 0; candidate < n; candidate++ {
+				if isMedoid[candidate] {
+					continue
+				}
+				change := 0.0
+				for jj := 0; jj < n; jj++ {
+					d := distances[jj][candidate]
+					if near.closest[jj] == c {
+						change += math.Min(d, near.dSecond[jj]) - near.dClosest[jj]
+					} else if d < near.dClosest[jj] {
+						change += d - near.dClosest[jj]
+					}
+				}
+				if change < bestChange {
+					bestMedoid, bestCandidate, bestChange = c, candidate, change
+				}
+			}
+		}
+		if bestMedoid < 0 {
+			return swaps, true
+		}
+		isMedoid[medoids[bestMedoid]], isMedoid[bestCandidate] = false, true
+		medoids[bestMedoid] = bestCandidate
+		swaps++
+		for jj := range distances {
+			near.update(distances, medoids, jj)
+		}
+	}
+	return swaps, false
+}
+
+// FasterPAM of Schubert and Rousseeuw eagerly swaps each candidate with the medoid whose removal costs the least, for k > 1
+func fasterPAM(distances [][]float64, medoids []int, maxIter int) (int, bool) {
+	n, k := len(distances), len(medoids)
+	isMedoid := make([]bool, n)
+	for _, medoid := range medoids {
+		isMedoid[medoid] = true
+	}
+	near := newNearest(distances, medoids)
+	// loss is the increase in cost from removing each medoid
+	loss := make([]float64, k)
+	removal := func() {
+		for c := range loss {
+			loss[c] = 0
+		}
+		for jj := range distances {
+			loss[near.closest[jj]] += near.dSecond[jj] - near.dClosest[jj]
+		}
+	}
+	removal()
+	swaps, last := 0, -1
+	change := make([]float64, k)
+	for pass := 0; pass < maxIter; pass++ {
+		for candidate := 0; candidate < n; candidate++ {
+			if candidate == last {
+				return swaps, true
+			}
+			if isMedoid[candidate] {
+				continue
+			}
+			copy(change, loss)
+			gain := 0.0
+			for jj := 0; jj < n; jj++ {
+				d := distances[jj][candidate]
+				if d < near.dClosest[jj] {
+					gain += d - near.dClosest[jj]
+					// the observation moves to the candidate whichever medoid is removed
+					change[near.closest[jj]] += near.dClosest[jj] - near.dSecond[jj]
+				} else if d < near.dSecond[jj] {
+					change[near.closest[jj]] += d - near.dSecond[jj]
+				}
+			}
+			best := 0
+			for c := range change {
+				if change[c] < change[best] {
+					best = c
+				}
+			}
+			if change[best]+gain >= 0 {
+				continue
+			}
+			isMedoid[medoids[best]], isMedoid[candidate] = false, true
+			medoids[best] = candidate
+			swaps++
+			last = candidate
+			for jj := range distances {
+				near.update(distances, medoids, jj)
+			}
+			removal()
+		}
+		if last < 0 {
+			return swaps, true
+		}
+	}
+	return swaps, false
+}
+
+// CLARA clusters samples of the data with k-medoids and keeps the medoids with the lowest cost on all of the data
+func CLARA(data [][]float64, k int, distanceFunction DistanceFunction, options MedoidOptions) (MedoidResult, error) {
+	if len(data) == 0 {
+		return MedoidResult{}, errors.New("no data")
+	}
+	if k < 1 || k > len(data) {
+		return MedoidResult{}, errors.New("k is out of range")
+	}
+	if options.Samples <= 0 {
+		options.Samples = DefaultClaraSamples
+	}
+	if options.SampleSize <= 0 {
+		options.SampleSize = 40 + 2*k
+	}
+	if options.SampleSize > len(data) {
+		options.SampleSize = len(data)
+	}
+	rng := rand.New(rand.NewSource(options.Seed))
+	var best MedoidResult
+	for s := 0; s < options.Samples; s++ {
+		// each sample keeps the best medoids so far
+		picked := make(map[int]bool, options.SampleSize)
+		indexes := make([]int, 0, options.SampleSize)
+		for _, medoid := range best.Medoids {
+			picked[medoid] = true
+			indexes = append(indexes, medoid)
+		}
+		for _, ii := range rng.Perm(len(data)) {
+			if len(indexes) == options.SampleSize {
+				break
+			}
+			if !picked[ii] {
+				picked[ii] = true
+				indexes = append(indexes, ii)
+			}
+		}
+		sample := make([][]float64, len(indexes))
+		for ii, index := range indexes {
+			sample[ii] = data[index]
+		}
+		sampleOptions := options
+		sampleOptions.Seed = options.Seed + int64(s)
+		result, err := KMedoids(sample, k, distanceFunction, sampleOptions)
+		if err != nil {
+			return MedoidResult{}, fmt.Errorf("sample %d: %w", s, err)
+		}
+		medoids := make([]int, k)
+		for c, medoid := range result.Medoids {
+			medoids[c] = indexes[medoid]
+		}
+		var distanceErr error
+		candidate := label(len(data), medoids, func(ii, jj int) (float64, error) {
+			d, err := distanceFunction(data[ii], data[jj])
+			if err != nil && distanceErr == nil {
+				distanceErr = fmt.Errorf("observations %d and %d: %w", ii, jj, err)
+			}
+			return d, err
+		})
+		if distanceErr != nil {
+			return MedoidResult{}, distanceErr
+		}
+		candidate.Swaps, candidate.Converged = result.Swaps, result.Converged
+		if best.Medoids == nil || candidate.Cost < best.Cost {
+			best = candidate
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,317 @@
+package kmeans
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultBatchSize is the default number of observations in a mini-batch
+	DefaultBatchSize = 1024
+	// DefaultReassignmentRatio is the default count relative to the largest count below which a mean is reassigned
+	DefaultReassignmentRatio = 0.01
+	// ReassignEvery is the number of mini-batches between reassignments of low count means
+	ReassignEvery = 10
+	// DefaultMaxNoImprovement is the default number of mini-batches without an improvement of the smoothed inertia that stops
+	DefaultMaxNoImprovement = 10
+)
+
+// Source is a stream of observations
+type Source interface {
+	// Next returns the next observation or io.EOF at the end of the stream
+	Next() ([]float64, error)
+}
+
+// Resetter is a source that can be read again from the start
+type Resetter interface {
+	Source
+	// Reset starts the stream again from the first observation
+	Reset() error
+}
+
+// SliceSource is a source of observations held in memory
+type SliceSource struct {
+	data  [][]float64
+	index int
+}
+
+// NewSliceSource creates a source of the observations
+func NewSliceSource(data [][]float64) *SliceSource {
+	return &SliceSource{data: data}
+}
+
+// Next returns the next observation
+func (s *SliceSource) Next() ([]float64, error) {
+	if s.index == len(s.data) {
+		return nil, io.EOF
+	}
+	s.index++
+	return s.data[s.index-1], nil
+}
+
+// Reset starts again from the first observation
+func (s *SliceSource) Reset() error {
+	s.index = 0
+	return nil
+}
+
+// CSVSource is a source of observations read from csv records of numbers
+type CSVSource struct {
+	reader *csv.Reader
+	line   int
+}
+
+// NewCSVSource creates a source that reads an observation from each record
+func NewCSVSource(r io.Reader, comma rune) *CSVSource {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.ReuseRecord = true
+	return &CSVSource{reader: reader}
+}
+
+// Next parses the next record
+func (c *CSVSource) Next() ([]float64, error) {
+	record, err := c.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	c.line++
+	observation := make([]float64, len(record))
+	for ii, field := range record {
+		value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("record %d field %d: %w", c.line, ii, err)
+		}
+		observation[ii] = value
+	}
+	return observation, nil
+}
+
+// Schedule is the learning rate of a mean that has count observations at a mini-batch
+type Schedule func(count, batch int) float64
+
+// InverseCount is the learning rate 1/count, which keeps each mean the average of its observations
+func InverseCount(count, batch int) float64 {
+	return 1 / float64(count)
+}
+
+// PowerDecay is the learning rate (batch+offset)^-exponent, exponent should be in (0.5, 1]
+func PowerDecay(offset, exponent float64) Schedule {
+	return func(count, batch int) float64 {
+		return math.Min(1, math.Pow(float64(batch)+offset, -exponent))
+	}
+}
+
+// MiniBatchOptions for mini-batch K-Means
+type MiniBatchOptions struct {
+	// Seed of the random number generator
+	Seed int64
+	// BatchSize is the number of observations in a mini-batch, defaults to DefaultBatchSize
+	BatchSize int
+	// InitSize is the number of observations the means are seeded with, defaults to three mini-batches
+	InitSize int
+	// MaxIter is the number of mini-batches, defaults to DefaultMaxIter
+	MaxIter int
+	// Tolerance is the total squared centroid shift of a converged mini-batch relative to the mean feature variance
+	// It is only checked after a full pass over a source that can be reset, defaults to DefaultTolerance, negative never stops
+	Tolerance float64
+	// MaxNoImprovement is the number of mini-batches without an improvement of the inertia per observation,
+	// smoothed over about a pass, that stops after a full pass, defaults to DefaultMaxNoImprovement, negative never stops
+	MaxNoImprovement int
+	// Schedule is the learning rate, defaults to InverseCount
+	Schedule Schedule
+	// ReassignmentRatio is the count relative to the largest count below which a mean is moved to a random observation
+	// Defaults to DefaultReassignmentRatio, negative never reassigns
+	ReassignmentRatio float64
+	// Squared is true if the distance is the square of a metric, see Options
+	Squared bool
+}
+
+// Read a batch of up to size observations, restarting the source at its end if it can be reset
+// Returns whether the source ended and the index of the first observation after a restart, -1 without a restart
+func batch(source Source, size int, restart bool) ([]ClusteredObservation, bool, int, error) {
+	data, wrap := make([]ClusteredObservation, 0, size), -1
+	for len(data) < size {
+		observation, err := source.Next()
+		if errors.Is(err, io.EOF) {
+			resetter, ok := source.(Resetter)
+			if !restart || !ok {
+				return data, true, wrap, nil
+			}
+			if err := resetter.Reset(); err != nil {
+				return nil, false, wrap, err
+			}
+			restart, wrap = false, len(data)
+			continue
+		} else if err != nil {
+			return nil, false, wrap, err
+		}
+		data = append(data, ClusteredObservation{Observation: observation})
+	}
+	return data, false, wrap, nil
+}
+
+// MiniBatch clusters a stream of observations with mini-batch K-Means
+// The result has no labels, the sizes are the number of observations each mean has seen and
+// the inertia is of the last mini-batch
+func MiniBatch(source Source, k int, distanceFunction DistanceFunction, options MiniBatchOptions) (Result, error) {
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+	if options.InitSize <= 0 {
+		options.InitSize = 3 * options.BatchSize
+	}
+	if options.InitSize < k {
+		options.InitSize = k
+	}
+	if options.MaxIter <= 0 {
+		options.MaxIter = DefaultMaxIter
+	}
+	if options.Tolerance == 0 {
+		options.Tolerance = DefaultTolerance
+	}
+	if options.Schedule == nil {
+		options.Schedule = InverseCount
+	}
+	if options.ReassignmentRatio == 0 {
+		options.ReassignmentRatio = DefaultReassignmentRatio
+	}
+	if options.MaxNoImprovement == 0 {
+		options.MaxNoImprovement = DefaultMaxNoImprovement
+	}
+
+	sample, _, _, err := batch(source, options.InitSize, false)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(sample) == 0 {
+		return Result{}, errors.New("no data")
+	}
+	if k < 1 || k > len(sample) {
+		return Result{}, errors.New("k is out of range")
+	}
+	rng := rand.New(rand.NewSource(options.Seed))
+	mean, err := seed(rng, sample, k, distanceFunction, options.Squared, 0)
+	if err != nil {
+		return Result{}, err
+	}
+	for ii := range mean {
+		mean[ii] = append(Observation(nil), mean[ii]...)
+	}
+	tolerance := options.Tolerance * variance(sample)
+	counts := make([]int, k)
+	result := Result{Seed: options.Seed, Stop: StopMaxIter}
+	// seen is the number of observations read, pass is the number in a pass once the source has restarted
+	seen, pass := len(sample), 0
+	// smoothed is the exponentially weighted average of the inertia per observation of the mini-batches
+	smoothed, best, stall := 0.0, math.Inf(1), 0
+	for result.Iterations < options.MaxIter {
+		data, end, wrap, err := batch(source, options.BatchSize, true)
+		if err != nil {
+			return Result{}, err
+		}
+		if len(data) == 0 {
+			result.Stop = StopEnd
+			break
+		}
+		if wrap >= 0 && pass == 0 {
+			pass = seen + wrap
+		}
+		seen += len(data)
+		result.Iterations++
+		previous := make([]Observation, k)
+		for ii := range mean {
+			previous[ii] = append(Observation(nil), mean[ii]...)
+		}
+		result.Inertia = 0
+		for ii, p := range data {
+			cluster, _, err := near(p, mean, distanceFunction)
+			if err != nil {
+				return Result{}, err
+			}
+			data[ii].ClusterNumber = cluster
+			counts[cluster]++
+			rate := options.Schedule(counts[cluster], result.Iterations)
+			for jj, value := range p.Observation {
+				mean[cluster][jj] += rate * (value - mean[cluster][jj])
+			}
+		}
+		for _, p := range data {
+			for jj, value := range p.Observation {
+				diff := value - mean[p.ClusterNumber][jj]
+				result.Inertia += diff * diff
+			}
+		}
+		if options.ReassignmentRatio > 0 && result.Iterations%ReassignEvery == 0 {
+			reassign(rng, data, mean, counts, options.ReassignmentRatio)
+		}
+		window := seen
+		if pass > 0 {
+			window = pass
+		}
+		alpha := math.Min(1, 2*float64(len(data))/float64(window+1))
+		if result.Iterations == 1 {
+			alpha = 1
+		}
+		smoothed = alpha*result.Inertia/float64(len(data)) + (1-alpha)*smoothed
+		if smoothed < best {
+			best, stall = smoothed, 0
+		} else if stall++; pass > 0 && options.MaxNoImprovement > 0 && stall >= options.MaxNoImprovement {
+			result.Stop = StopNoImprovement
+			break
+		}
+		shift := 0.0
+		for ii := range mean {
+			for jj, value := range mean[ii] {
+				diff := value - previous[ii][jj]
+				shift += diff * diff
+			}
+		}
+		if pass > 0 && shift <= tolerance {
+			result.Stop = StopTolerance
+			break
+		}
+		if end {
+			result.Stop = StopEnd
+			break
+		}
+	}
+	result.Centroids, result.Sizes = mean, counts
+	result.Converged = result.Stop == StopTolerance || result.Stop == StopNoImprovement
+	return result, nil
+}
+
+// Move the means with low counts to random observations of the batch
+func reassign(rng *rand.Rand, data []ClusteredObservation, mean []Observation, counts []int, ratio float64) {
+	largest, smallest := 0, math.MaxInt
+	for _, count := range counts {
+		if count > largest {
+			largest = count
+		}
+	}
+	low := make([]int, 0, len(counts))
+	for ii, count := range counts {
+		if float64(count) < ratio*float64(largest) {
+			low = append(low, ii)
+		} else if count < smallest {
+			smallest = count
+		}
+	}
+	if len(low) == 0 || len(low) == len(counts) {
+		return
+	}
+	picks := rng.Perm(len(data))
+	for ii, cluster := range low {
+		if ii == len(picks) {
+			break
+		}
+		mean[cluster] = append(Observation(nil), data[picks[ii]].Observation...)
+		counts[cluster] = smallest
+	}
+}
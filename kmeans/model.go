@@ -0,0 +1,175 @@
+package kmeans
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Model is a fitted K-Means model that assigns new observations to clusters
+type Model struct {
+	// Centroids are the cluster means
+	Centroids []Observation
+	// Distance is the registered name of the distance function, or MahalanobisName
+	Distance string
+	// Covariances are the covariances of a Mahalanobis model, one shared by the clusters or one for each cluster
+	Covariances [][][]float64
+	// Metadata are free form notes saved with the model
+	Metadata map[string]string
+
+	// distanceFunctions are the distance to each centroid
+	distanceFunctions []DistanceFunction
+}
+
+// MahalanobisName is the distance name of a model with Mahalanobis distances
+const MahalanobisName = "mahalanobis"
+
+// Check that there are centroids of the same length
+func checkCentroids(centroids []Observation) error {
+	if len(centroids) == 0 {
+		return errors.New("no centroids")
+	}
+	for _, centroid := range centroids[1:] {
+		if len(centroid) != len(centroids[0]) {
+			return errors.New("centroids have different lengths")
+		}
+	}
+	return nil
+}
+
+// NewModel creates a model from centroids and the name of a registered distance function
+func NewModel(centroids []Observation, distance string) (*Model, error) {
+	if err := checkCentroids(centroids); err != nil {
+		return nil, err
+	}
+	distanceFunction, err := Lookup(distance)
+	if err != nil {
+		return nil, err
+	}
+	distanceFunctions := make([]DistanceFunction, len(centroids))
+	for ii := range distanceFunctions {
+		distanceFunctions[ii] = distanceFunction
+	}
+	return &Model{
+		Centroids:         centroids,
+		Distance:          distance,
+		distanceFunctions: distanceFunctions,
+	}, nil
+}
+
+// NewMahalanobisModel creates a model from centroids and Mahalanobis covariances,
+// one covariance shared by the clusters or one for each cluster
+func NewMahalanobisModel(centroids []Observation, covariances [][][]float64) (*Model, error) {
+	if err := checkCentroids(centroids); err != nil {
+		return nil, err
+	}
+	if len(covariances) != 1 && len(covariances) != len(centroids) {
+		return nil, fmt.Errorf("%d covariances for %d centroids", len(covariances), len(centroids))
+	}
+	distances, err := mahalanobis(covariances)
+	if err != nil {
+		return nil, err
+	}
+	distanceFunctions := make([]DistanceFunction, len(centroids))
+	for ii := range distanceFunctions {
+		distanceFunctions[ii] = distances[ii%len(distances)]
+	}
+	return &Model{
+		Centroids:         centroids,
+		Distance:          MahalanobisName,
+		Covariances:       covariances,
+		distanceFunctions: distanceFunctions,
+	}, nil
+}
+
+// Model of the result using the named distance function
+// MahalanobisName uses the covariances of a result from FitMahalanobis
+func (r Result) Model(distance string) (*Model, error) {
+	if distance == MahalanobisName {
+		if len(r.Covariances) == 0 {
+			return nil, errors.New("the result has no covariances")
+		}
+		return NewMahalanobisModel(r.Centroids, r.Covariances)
+	}
+	return NewModel(r.Centroids, distance)
+}
+
+// Check the length of an observation
+func (m *Model) check(observation []float64) error {
+	if len(observation) != len(m.Centroids[0]) {
+		return fmt.Errorf("observation has length %d, want %d", len(observation), len(m.Centroids[0]))
+	}
+	return nil
+}
+
+// Predict the cluster of an observation
+func (m *Model) Predict(observation []float64) (int, error) {
+	distances, err := m.Transform(observation)
+	if err != nil {
+		return 0, err
+	}
+	cluster := 0
+	for ii, distance := range distances {
+		if distance < distances[cluster] {
+			cluster = ii
+		}
+	}
+	return cluster, nil
+}
+
+// PredictBatch predicts the cluster of each observation
+func (m *Model) PredictBatch(data [][]float64) ([]int, error) {
+	labels := make([]int, len(data))
+	for ii, observation := range data {
+		cluster, err := m.Predict(observation)
+		if err != nil {
+			return nil, fmt.Errorf("observation %d: %w", ii, err)
+		}
+		labels[ii] = cluster
+	}
+	return labels, nil
+}
+
+// Transform an observation into its distances to the centroids
+func (m *Model) Transform(observation []float64) ([]float64, error) {
+	if err := m.check(observation); err != nil {
+		return nil, err
+	}
+	distances := make([]float64, len(m.Centroids))
+	for ii, centroid := range m.Centroids {
+		distance, err := m.distanceFunctions[ii](observation, centroid)
+		if err != nil {
+			return nil, err
+		}
+		distances[ii] = distance
+	}
+	return distances, nil
+}
+
+// Memberships of an observation in each cluster with the fuzzy c-means fuzzifier, which must be greater than 1
+// The memberships sum to one, lower fuzzifiers are closer to hard assignments
+func (m *Model) Memberships(observation []float64, fuzzifier float64) ([]float64, error) {
+	if !(fuzzifier > 1) {
+		return nil, fmt.Errorf("fuzzifier %v is not greater than 1", fuzzifier)
+	}
+	distances, err := m.Transform(observation)
+	if err != nil {
+		return nil, err
+	}
+	return memberships(distances, Squared(m.Distance), fuzzifier), nil
+}
+
+// MembershipsBatch computes the memberships of each observation
+func (m *Model) MembershipsBatch(data [][]float64, fuzzifier float64) ([][]float64, error) {
+	if !(fuzzifier > 1) {
+		return nil, fmt.Errorf("fuzzifier %v is not greater than 1", fuzzifier)
+	}
+	result := make([][]float64, len(data))
+	for ii, observation := range data {
+		u, err := m.Memberships(observation, fuzzifier)
+		if err != nil {
+			return nil, fmt.Errorf("observation %d: %w", ii, err)
+		}
+		result[ii] = u
+	}
+	return result, nil
+}
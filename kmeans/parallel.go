@@ -0,0 +1,67 @@
+package kmeans
+
+import (
+	"runtime"
+)
+
+// ChunkSize is the number of observations in each unit of parallel work
+// The chunks don't depend on the number of workers, so results combined in chunk order are deterministic
+const ChunkSize = 1024
+
+// Run f on chunks of size items of [0, n) with at most workers goroutines, workers defaults to GOMAXPROCS
+func parallel(n, size, workers int, f func(chunk, start, end int)) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	chunks := (n + size - 1) / size
+	if workers == 1 || chunks <= 1 {
+		for chunk := 0; chunk < chunks; chunk++ {
+			f(chunk, chunk*size, min(n, (chunk+1)*size))
+		}
+		return
+	}
+	done := make(chan bool, workers)
+	run := func(chunk int) {
+		f(chunk, chunk*size, min(n, (chunk+1)*size))
+		done <- true
+	}
+	flight := 0
+	for chunk := 0; chunk < chunks; chunk++ {
+		if flight == workers {
+			<-done
+			flight--
+		}
+		go run(chunk)
+		flight++
+	}
+	for ; flight > 0; flight-- {
+		<-done
+	}
+}
+
+// Run f on every observation index in parallel chunks
+// Returns the number of calls that returned true and the error of the first chunk that failed
+func each(n, workers int, f func(ii int) (bool, error)) (int, error) {
+	chunks := (n + ChunkSize - 1) / ChunkSize
+	counts, errs := make([]int, chunks), make([]error, chunks)
+	parallel(n, ChunkSize, workers, func(chunk, start, end int) {
+		for ii := start; ii < end; ii++ {
+			ok, err := f(ii)
+			if err != nil {
+				errs[chunk] = err
+				return
+			}
+			if ok {
+				counts[chunk]++
+			}
+		}
+	})
+	total := 0
+	for chunk := range counts {
+		if errs[chunk] != nil {
+			return 0, errs[chunk]
+		}
+		total += counts[chunk]
+	}
+	return total, nil
+}
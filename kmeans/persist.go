@@ -0,0 +1,130 @@
+package kmeans
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ModelVersion is the version of the saved model format
+const ModelVersion = 1
+
+// modelMagic starts the binary encoding of a model
+var modelMagic = []byte("ULKM")
+
+// ErrVersion means a saved model is from an unsupported version of the format
+var ErrVersion = errors.New("unsupported model version")
+
+// savedModel is the saved form of a model
+type savedModel struct {
+	Version     int               `json:"version"`
+	Distance    string            `json:"distance"`
+	Centroids   [][]float64       `json:"centroids"`
+	Covariances [][][]float64     `json:"covariances,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// save converts the model to its saved form
+func (m *Model) save() savedModel {
+	centroids := make([][]float64, len(m.Centroids))
+	for ii, centroid := range m.Centroids {
+		centroids[ii] = centroid
+	}
+	return savedModel{
+		Version:     ModelVersion,
+		Distance:    m.Distance,
+		Centroids:   centroids,
+		Covariances: m.Covariances,
+		Metadata:    m.Metadata,
+	}
+}
+
+// load sets the model from its saved form
+func (m *Model) load(saved savedModel) error {
+	if saved.Version != ModelVersion {
+		return fmt.Errorf("%w %d", ErrVersion, saved.Version)
+	}
+	centroids := make([]Observation, len(saved.Centroids))
+	for ii, centroid := range saved.Centroids {
+		centroids[ii] = centroid
+	}
+	var model *Model
+	var err error
+	if saved.Distance == MahalanobisName {
+		model, err = NewMahalanobisModel(centroids, saved.Covariances)
+	} else {
+		model, err = NewModel(centroids, saved.Distance)
+	}
+	if err != nil {
+		return err
+	}
+	model.Metadata = saved.Metadata
+	*m = *model
+	return nil
+}
+
+// MarshalJSON encodes the model as versioned JSON
+func (m *Model) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.save())
+}
+
+// UnmarshalJSON decodes a model from versioned JSON
+func (m *Model) UnmarshalJSON(data []byte) error {
+	var saved savedModel
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	return m.load(saved)
+}
+
+// MarshalBinary encodes the model as a magic number, a version and a gob
+func (m *Model) MarshalBinary() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.Write(modelMagic)
+	binary.Write(&buffer, binary.LittleEndian, uint16(ModelVersion))
+	if err := gob.NewEncoder(&buffer).Encode(m.save()); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a model encoded by MarshalBinary
+func (m *Model) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, modelMagic) {
+		return errors.New("not a binary model")
+	}
+	data = data[len(modelMagic):]
+	if len(data) < 2 {
+		return io.ErrUnexpectedEOF
+	}
+	if version := binary.LittleEndian.Uint16(data); version != ModelVersion {
+		return fmt.Errorf("%w %d", ErrVersion, version)
+	}
+	var saved savedModel
+	if err := gob.NewDecoder(bytes.NewReader(data[2:])).Decode(&saved); err != nil {
+		return err
+	}
+	return m.load(saved)
+}
+
+// ReadModel reads a model saved as JSON or binary
+func ReadModel(r io.Reader) (*Model, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	model := &Model{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = model.UnmarshalJSON(trimmed)
+	} else {
+		err = model.UnmarshalBinary(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return model, nil
+}
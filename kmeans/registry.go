@@ -0,0 +1,108 @@
+package kmeans
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry of distance functions by name
+var registry = struct {
+	sync.RWMutex
+	distances map[string]DistanceFunction
+	// squared are the names of the distances that are squares of a metric
+	squared map[string]bool
+}{
+	squared: map[string]bool{
+		"sqeuclidean": true,
+	},
+	distances: map[string]DistanceFunction{
+		"euclidean":   EuclideanDistance,
+		"sqeuclidean": SquaredEuclideanDistance,
+		"manhattan":   ManhattanDistance,
+		"chebyshev":   ChebyshevDistance,
+		"hamming":     HammingDistance,
+		"braycurtis":  BrayCurtisDistance,
+		"canberra":    CanberraDistance,
+		"cosine":      CosineDistance,
+		"correlation": CorrelationDistance,
+	},
+}
+
+// Families of distance functions with a numeric parameter, looked up as name-parameter such as minkowski-3
+var families = map[string]func(parameter float64) (DistanceFunction, error){
+	"minkowski": Minkowski,
+}
+
+// Register a distance function under a name, replacing any function with that name
+func Register(name string, distanceFunction DistanceFunction) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.distances[name] = distanceFunction
+	delete(registry.squared, name)
+}
+
+// RegisterSquared registers a distance function that is the square of a metric, such as squared euclidean distance
+// Squared reports it for the name so Options.Squared can be set
+func RegisterSquared(name string, distanceFunction DistanceFunction) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.distances[name] = distanceFunction
+	registry.squared[name] = true
+}
+
+// Squared is true if the named distance is the square of a metric
+func Squared(name string) bool {
+	registry.RLock()
+	defer registry.RUnlock()
+	return registry.squared[name]
+}
+
+// The k-means++ weight of a distance, the square of the metric
+func weight(distance float64, squared bool) float64 {
+	if squared {
+		return distance
+	}
+	return distance * distance
+}
+
+// Lookup a distance function by name
+func Lookup(name string) (DistanceFunction, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	distanceFunction, ok := registry.distances[name]
+	if ok {
+		return distanceFunction, nil
+	}
+	if index := strings.LastIndex(name, "-"); index > 0 {
+		if family, ok := families[name[:index]]; ok {
+			parameter, err := strconv.ParseFloat(name[index+1:], 64)
+			if err != nil {
+				return nil, fmt.Errorf("distance %q: %w", name, err)
+			}
+			distanceFunction, err := family(parameter)
+			if err != nil {
+				return nil, fmt.Errorf("distance %q: %w", name, err)
+			}
+			return distanceFunction, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown distance %q", name)
+}
+
+// Names of the registered distance functions and families in order
+func Names() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	names := make([]string, 0, len(registry.distances))
+	for name := range registry.distances {
+		names = append(names, name)
+	}
+	for name := range families {
+		names = append(names, name+"-p")
+	}
+	sort.Strings(names)
+	return names
+}
@@ -5,189 +5,115 @@
 package main
 
 import (
-	"archive/zip"
-	"bytes"
 	"embed"
-	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"math"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"sort"
-	"strconv"
+	"strings"
 
+	"github.com/pointlander/ultra/consensus"
 	"github.com/pointlander/ultra/kmeans"
+	"github.com/pointlander/ultra/metrics"
 )
 
 //go:embed iris.zip
 var Iris embed.FS
 
-// Fisher is the fisher iris data
-type Fisher struct {
-	Measures []float64
-	Label    string
-	Cluster  int
-	Index    int
-}
-
-// Labels maps iris labels to ints
-var Labels = map[string]int{
-	"Iris-setosa":     0,
-	"Iris-versicolor": 1,
-	"Iris-virginica":  2,
+// Flatten flattens feature vectors into a matrix with a row per vector
+func Flatten(features [][]float64) Matrix {
+	input := NewMatrix(len(features[0]), len(features))
+	for i := range features {
+		for _, value := range features[i] {
+			input.Data = append(input.Data, complex(value, 0))
+		}
+	}
+	return input
 }
 
-// Load loads the iris data set
-func Load() []Fisher {
-	file, err := Iris.Open("iris.zip")
-	if err != nil {
-		panic(err)
+// Score prints the external validation scores of a clustering
+func Score(data *Dataset, clusters []int) error {
+	if !data.Labeled() {
+		return nil
 	}
-	defer file.Close()
-
-	data, err := io.ReadAll(file)
-	if err != nil {
-		panic(err)
+	if len(clusters) != data.Rows() {
+		return &ShapeError{What: "clusters", Row: -1, Got: len(clusters), Want: data.Rows()}
 	}
-
-	fisher := make([]Fisher, 0, 8)
-	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	scores, err := metrics.Compare(data.Targets, clusters)
 	if err != nil {
-		panic(err)
-	}
-	for _, f := range reader.File {
-		if f.Name == "iris.data" {
-			iris, err := f.Open()
-			if err != nil {
-				panic(err)
-			}
-			reader := csv.NewReader(iris)
-			data, err := reader.ReadAll()
-			if err != nil {
-				panic(err)
-			}
-			for i, item := range data {
-				record := Fisher{
-					Measures: make([]float64, 4),
-					Label:    item[4],
-					Index:    i,
-				}
-				for i := range item[:4] {
-					f, err := strconv.ParseFloat(item[i], 64)
-					if err != nil {
-						panic(err)
-					}
-					record.Measures[i] = f
-				}
-				fisher = append(fisher, record)
-			}
-			iris.Close()
-		}
+		return err
 	}
-	return fisher
+	fmt.Println(scores.Contingency.Table)
+	fmt.Println(scores)
+	return nil
 }
 
-// Entropy calculates the entropy of the clustering
-func Entropy(fisher []Fisher, c int, clusters []int) {
-	ab := make([][]float64, 3)
-	for i := range ab {
-		ab[i] = make([]float64, c)
-	}
-	ba := make([][]float64, c)
-	for i := range ba {
-		ba[i] = make([]float64, 3)
-	}
-	for i := range fisher {
-		a := int(Labels[fisher[i].Label])
-		b := clusters[i]
-		ab[a][b]++
-		ba[b][a]++
-	}
-	entropy := 0.0
-	for i := 0; i < c; i++ {
-		entropy += (1.0 / float64(c)) * math.Log(1.0/float64(c))
-	}
-	fmt.Println(-entropy, -(1.0/float64(c))*math.Log(1.0/float64(c)))
-	for i := range ab {
-		entropy := 0.0
-		for _, value := range ab[i] {
-			if value > 0 {
-				p := value / 150
-				entropy += p * math.Log(p)
-			}
+// Measures are the variances of four rounds of Process for each row, the space consensus clusters and k is selected in
+func Measures(rng *rand.Rand, data *Dataset) ([][]float64, error) {
+	rows, rounds := data.Rows(), 4
+	features, input := data.Copy(), make([][]float64, rows)
+	for i := range input {
+		input[i] = make([]float64, 0, rounds)
+	}
+	for r := 0; r < rounds; r++ {
+		variances, err := Process(rng, Flatten(features), data)
+		if err != nil {
+			return nil, err
 		}
-		entropy = -entropy
-		fmt.Println("ab", i, entropy)
-	}
-	for i := range ba {
-		entropy := 0.0
-		for _, value := range ba[i] {
-			if value > 0 {
-				p := value / 150
-				entropy += p * math.Log(p)
-			}
+		if len(variances) != rows {
+			return nil, &ShapeError{What: "variances", Row: -1, Got: len(variances), Want: rows}
+		}
+		for i := range features {
+			features[i] = append(features[i], variances[i])
+			input[i] = append(input[i], variances[i])
 		}
-		entropy = -entropy
-		fmt.Println("ba", i, entropy)
 	}
+	return input, nil
 }
 
-// Cluster clusters the data
-func Cluster(k int, vars [][]float64) []int {
-	fisher := Load()
-	input := make([][]float64, 0, 8)
-	for i, item := range fisher {
-		measures := make([]float64, len(vars))
-		for j := range measures {
-			measures[j] = vars[j][i]
-		}
-		item.Measures = measures
-		input = append(input, item.Measures)
-	}
-	meta := make([][]float64, len(fisher))
-	for i := range meta {
-		meta[i] = make([]float64, len(fisher))
-	}
-	for i := 0; i < 100; i++ {
-		clusters, _, err := kmeans.Kmeans(int64(i+1), input, k, kmeans.SquaredEuclideanDistance, -1)
-		if err != nil {
-			panic(err)
-		}
-		for i := 0; i < len(meta); i++ {
-			target := clusters[i]
-			for j, v := range clusters {
-				if v == target {
-					meta[i][j]++
-				}
-			}
-		}
+// Cluster clusters the measures of the rows, returning the clusters and the co-association matrix
+func Cluster(data *Dataset, k int, input [][]float64, config consensus.Config) (*consensus.Result, error) {
+	rows, width := data.Rows(), data.Width()
+	if k < 1 || k > rows {
+		return nil, fmt.Errorf("can't make %d clusters from %d rows", k, rows)
 	}
-	clusters, _, err := kmeans.Kmeans(1, meta, k, kmeans.SquaredEuclideanDistance, -1)
+	if len(input) != rows {
+		return nil, &ShapeError{What: "measures", Row: -1, Got: len(input), Want: rows}
+	}
+	result, err := consensus.Cluster(input, k, config)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	for key, value := range clusters {
-		fisher[key].Cluster = value
+	clusters := result.Labels
+	fmt.Println("combiner", result.Combiner, "anmi", result.ANMI[result.Combiner])
+	sum, counts := make([][]float64, k), make([]float64, k)
+	for i := range sum {
+		sum[i] = make([]float64, width)
 	}
-	sum, counts := make([][4]float64, k), make([]float64, k)
-	for _, v := range fisher {
-		for i, vv := range v.Measures {
-			sum[v.Cluster][i] += vv
+	for key, v := range data.Features {
+		for i, vv := range v {
+			sum[clusters[key]][i] += vv
 		}
-		counts[v.Cluster]++
-		//fmt.Println(v.Label, v.Cluster)
+		counts[clusters[key]]++
+		//fmt.Println(data.Label(key), clusters[key])
 	}
 	for i := range sum {
 		for j := range sum[i] {
 			sum[i][j] /= counts[i]
 		}
 	}
-	stddev := make([][4]float64, k)
-	for _, v := range fisher {
-		for i, vv := range v.Measures {
-			diff := sum[v.Cluster][i] - vv
-			stddev[v.Cluster][i] += diff * diff
+	stddev := make([][]float64, k)
+	for i := range stddev {
+		stddev[i] = make([]float64, width)
+	}
+	for key, v := range data.Features {
+		for i, vv := range v {
+			diff := sum[clusters[key]][i] - vv
+			stddev[clusters[key]][i] += diff * diff
 		}
 	}
 	for i := range stddev {
@@ -195,11 +121,14 @@ func Cluster(k int, vars [][]float64) []int {
 			stddev[i][j] = math.Sqrt(stddev[i][j] / counts[i])
 		}
 	}
-	outliers := make([][4]int, k)
-	for _, v := range fisher {
-		for j, vv := range v.Measures {
-			if math.Abs(vv-sum[v.Cluster][j]) > 3*stddev[v.Cluster][j] {
-				outliers[v.Cluster][j]++
+	outliers := make([][]int, k)
+	for i := range outliers {
+		outliers[i] = make([]int, width)
+	}
+	for key, v := range data.Features {
+		for j, vv := range v {
+			if math.Abs(vv-sum[clusters[key]][j]) > 3*stddev[clusters[key]][j] {
+				outliers[clusters[key]][j]++
 			}
 		}
 	}
@@ -211,45 +140,46 @@ func Cluster(k int, vars [][]float64) []int {
 		}
 	}
 	fmt.Println("total", total)
-	return clusters
+	return result, nil
 }
 
-func Split(fisher []Fisher, col int) (float64, int) {
-	sort.Slice(fisher, func(i, j int) bool {
-		return fisher[i].Measures[col] < fisher[j].Measures[col]
+// Split finds the split of the rows in order along col that most reduces the variance
+func Split(features [][]float64, order []int, col int) (float64, int) {
+	sort.Slice(order, func(i, j int) bool {
+		return features[order[i]][col] < features[order[j]][col]
 	})
 	sum := 0.0
-	for _, item := range fisher {
-		sum += item.Measures[col]
+	for _, row := range order {
+		sum += features[row][col]
 	}
-	average := sum / float64(len(fisher))
+	average := sum / float64(len(order))
 	variance := 0.0
-	for _, item := range fisher {
-		diff := item.Measures[col] - average
+	for _, row := range order {
+		diff := features[row][col] - average
 		variance += diff * diff
 	}
-	variance /= float64(len(fisher))
+	variance /= float64(len(order))
 	max, index := 0.0, 0
-	for i := 1; i < len(fisher)-1; i++ {
+	for i := 1; i < len(order)-1; i++ {
 		sumA, sumB := 0.0, 0.0
 		countA, countB := 0.0, 0.0
-		for _, item := range fisher[:i] {
-			sumA += item.Measures[col]
+		for _, row := range order[:i] {
+			sumA += features[row][col]
 			countA++
 		}
-		for _, item := range fisher[i:] {
-			sumB += item.Measures[col]
+		for _, row := range order[i:] {
+			sumB += features[row][col]
 			countB++
 		}
 		averageA := sumA / countA
 		averageB := sumB / countB
 		varianceA, varianceB := 0.0, 0.0
-		for _, item := range fisher[:i] {
-			diff := item.Measures[col] - averageA
+		for _, row := range order[:i] {
+			diff := features[row][col] - averageA
 			varianceA += diff * diff
 		}
-		for _, item := range fisher[i:] {
-			diff := item.Measures[col] - averageB
+		for _, row := range order[i:] {
+			diff := features[row][col] - averageB
 			varianceB += diff * diff
 		}
 		varianceA /= countA
@@ -262,109 +192,444 @@ func Split(fisher []Fisher, col int) (float64, int) {
 }
 
 // Variance cluster is variance based clustering
-func VarianceCluster() {
+func VarianceCluster(data *Dataset, distance kmeans.DistanceFunction, config consensus.Config) error {
 	rng := rand.New(rand.NewSource(1))
-	fisher := Load()
-	for i := 0; i < 33; i++ {
-		input := NewMatrix(4+i, 150)
-		for i := range fisher {
-			for _, value := range fisher[i].Measures {
-				input.Data = append(input.Data, complex(value, 0))
-			}
+	features, width, iterations := data.Copy(), data.Width(), 33
+	if data.Rows() < 3 {
+		return fmt.Errorf("can't split %d rows into 3 clusters", data.Rows())
+	}
+	for i := 0; i < iterations; i++ {
+		variances, err := Process(rng, Flatten(features), data)
+		if err != nil {
+			return err
 		}
-		variances := Process(rng, input, fisher)
-		for i := range fisher {
-			fisher[i].Measures = append(fisher[i].Measures, variances[i])
+		for i := range features {
+			features[i] = append(features[i], variances[i])
 		}
 	}
 
-	cluster := func(fisher []Fisher, col int) []int {
-		clusters := make([]int, len(fisher))
-		_, index := Split(fisher, col)
-		max1, index1 := Split(fisher[:index], col)
-		max2, index2 := Split(fisher[index:], col)
+	order := make([]int, len(features))
+	for i := range order {
+		order[i] = i
+	}
+	cluster := func(order []int, col int) []int {
+		clusters := make([]int, len(order))
+		_, index := Split(features, order, col)
+		max1, index1 := Split(features, order[:index], col)
+		max2, index2 := Split(features, order[index:], col)
 		if max1 > max2 {
-			for i, item := range fisher {
+			for i, row := range order {
 				if i < index1 {
-					clusters[item.Index] = 0
+					clusters[row] = 0
 				} else if i < index {
-					clusters[item.Index] = 1
+					clusters[row] = 1
 				} else {
-					clusters[item.Index] = 2
+					clusters[row] = 2
 				}
 			}
 		} else {
-			for i, item := range fisher {
+			for i, row := range order {
 				if i < index {
-					clusters[item.Index] = 0
+					clusters[row] = 0
 				} else if i < index+index2 {
-					clusters[item.Index] = 1
+					clusters[row] = 1
 				} else {
-					clusters[item.Index] = 2
+					clusters[row] = 2
 				}
 			}
 		}
 		return clusters
 	}
-	meta := make([][]float64, len(fisher))
-	for i := range meta {
-		meta[i] = make([]float64, len(fisher))
-	}
-	for i := 4; i < 37; i++ {
-		clusters := cluster(fisher, i)
-		for i := 0; i < len(meta); i++ {
-			target := clusters[i]
-			for j, v := range clusters {
-				if v == target {
-					meta[i][j]++
-				}
-			}
-		}
+	labelings := make([][]int, 0, iterations)
+	for i := width; i < width+iterations; i++ {
+		labelings = append(labelings, cluster(order, i))
 	}
-	clusters, _, err := kmeans.Kmeans(1, meta, 3, kmeans.SquaredEuclideanDistance, -1)
+	result, err := consensus.Combine(labelings, 3, config)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	fisher = Load()
+	clusters := result.Labels
 	for i, v := range clusters {
-		fmt.Println(fisher[i].Label, v)
+		fmt.Println(data.IDs[i], data.Label(i), v)
 	}
-	Entropy(fisher, 3, clusters)
+	if *FlagFuzzy != 0 {
+		if err := Fuzzy(data, 3, distance, result); err != nil {
+			return err
+		}
+	}
+	return Score(data, clusters)
 }
 
 var (
 	// FlagVariance variance mode
 	FlagVariance = flag.Bool("variance", false, "variance mode")
+	// FlagData is the data set to cluster, - for stdin
+	FlagData = flag.String("data", "", "csv or tsv data file, - for stdin, defaults to iris")
+	// FlagComma is the field delimiter
+	FlagComma = flag.String("comma", "", "field delimiter, defaults to , or tab for .tsv files")
+	// FlagHeader is the header row mode
+	FlagHeader = flag.String("header", "auto", "header row: auto, yes or no")
+	// FlagLabel is the label column
+	FlagLabel = flag.Int("label", NoColumn, "label column, -1 for none")
+	// FlagID is the row id column
+	FlagID = flag.Int("id", NoColumn, "row id column, -1 for none")
+	// FlagColumns are the feature columns
+	FlagColumns = flag.String("columns", "", "feature columns such as 0,2-4, defaults to all but the label and id")
+	// FlagSelect is the method for selecting k
+	FlagSelect = flag.String("select", "", "select k with gap, elbow, silhouette, pac or delta")
+	// FlagReferences is the number of reference data sets for the gap statistic
+	FlagReferences = flag.Int("references", 10, "number of reference data sets for the gap statistic")
+	// FlagResamples is the number of consensus resamples
+	FlagResamples = flag.Int("resamples", 100, "number of consensus resamples")
+	// FlagSubsample is the fraction of rows in each consensus resample
+	FlagSubsample = flag.Float64("subsample", 1, "fraction of rows in each consensus resample")
+	// FlagBagging is the fraction of features in each consensus resample
+	FlagBagging = flag.Float64("bagging", 1, "fraction of features in each consensus resample")
+	// FlagSeed is the seed of the first consensus resample
+	FlagSeed = flag.Int64("seed", 1, "seed of the first consensus resample")
+	// FlagStorage is how the co-association matrix is stored
+	FlagStorage = flag.String("storage", consensus.StoragePacked, "co-association storage: packed or sparse")
+	// FlagThreshold is the smallest co-association kept by sparse storage
+	FlagThreshold = flag.Float64("threshold", 0.1, "smallest co-association kept by sparse storage")
+	// FlagCombiner combines the base clusterings
+	FlagCombiner = flag.String("combiner", "cspa", "consensus combiner: cspa, hgpa, mcla or best")
+	// FlagFinisher partitions the co-association matrix
+	FlagFinisher = flag.String("finisher", "kmeans", "consensus finisher: "+strings.Join(consensus.FinisherNames(), ", "))
+	// FlagDistance is the k-means distance
+	FlagDistance = flag.String("distance", "sqeuclidean", "k-means distance: "+strings.Join(kmeans.Names(), ", "))
+	// FlagInit is the k-means init method
+	FlagInit = flag.String("init", "kmeans++", "k-means init: kmeans++, random or kmeans||")
+	// FlagFuzzy is the fuzzifier of fuzzy c-means, which flags low confidence rows
+	FlagFuzzy = flag.Float64("fuzzy", 0, "fuzzifier greater than 1 to flag low confidence rows with fuzzy c-means, 0 for none")
+	// FlagConfidence is the membership below which a row has low confidence
+	FlagConfidence = flag.Float64("confidence", 0.6, "membership below which a row has low confidence")
+	// FlagSave is the file the consensus result of the selected k is saved to
+	FlagSave = flag.String("save", "", "save the consensus result of the selected k, json for .json files else binary")
+	// FlagModel is the file the model of the consensus clusters of the selected k is saved to
+	FlagModel = flag.String("model", "", "save a nearest centroid model of the consensus clusters of the selected k, json for .json files else binary")
+	// FlagPredict is a saved k-means model used to predict the cluster of each row
+	FlagPredict = flag.String("predict", "", "predict the cluster of each row with a saved k-means model")
 )
 
+// Fuzzy prints the rows of the consensus clusters with low fuzzy c-means membership
+// Each fuzzy cluster adds its memberships to the consensus cluster it shares the most rows with,
+// a row has low confidence when its membership in its own consensus cluster is below the confidence flag
+func Fuzzy(data *Dataset, k int, distance kmeans.DistanceFunction, result *consensus.Result) error {
+	fuzzy, err := kmeans.FuzzyCMeans(data.Features, k, distance, kmeans.FuzzyOptions{
+		Seed:      *FlagSeed,
+		Fuzzifier: *FlagFuzzy,
+		Squared:   kmeans.Squared(*FlagDistance),
+	})
+	if err != nil {
+		return err
+	}
+	memberships := Soft(fuzzy.Memberships, fuzzy.Labels, result.Labels, k)
+	fmt.Println("fuzzy objective", fuzzy.Objective, "iterations", fuzzy.Iterations, "converged", fuzzy.Converged)
+	fmt.Println("low confidence: row label cluster membership item_consensus")
+	for row, cluster := range result.Labels {
+		if membership := memberships[row][cluster]; membership < *FlagConfidence {
+			id := fmt.Sprint(row)
+			if data.IDs != nil {
+				id = data.IDs[row]
+			}
+			fmt.Println(id, data.Label(row), cluster, membership, result.Summary.ItemConsensus[row])
+		}
+	}
+	return nil
+}
+
+// Soft maps the memberships of fuzzy clusters onto the k clusters of a hard labeling
+// Each fuzzy cluster adds its memberships to the cluster that has the most of its rows
+func Soft(memberships [][]float64, fuzzy, clusters []int, k int) [][]float64 {
+	fuzzyK := 0
+	if len(memberships) > 0 {
+		fuzzyK = len(memberships[0])
+	}
+	overlap := make([][]int, fuzzyK)
+	for i := range overlap {
+		overlap[i] = make([]int, k)
+	}
+	for row, label := range fuzzy {
+		overlap[label][clusters[row]]++
+	}
+	target := make([]int, fuzzyK)
+	for i, counts := range overlap {
+		for j, count := range counts {
+			if count > counts[target[i]] {
+				target[i] = j
+			}
+		}
+	}
+	soft := make([][]float64, len(memberships))
+	for row, u := range memberships {
+		soft[row] = make([]float64, k)
+		for i, membership := range u {
+			soft[row][target[i]] += membership
+		}
+	}
+	return soft
+}
+
+// Save saves a model or result to a file as json if the file ends in .json else as binary
+func Save(name string, v interface {
+	MarshalJSON() ([]byte, error)
+	MarshalBinary() ([]byte, error)
+}) error {
+	marshal := v.MarshalBinary
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		marshal = v.MarshalJSON
+	}
+	encoded, err := marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, encoded, 0644)
+}
+
+// InputMeasures is the input metadata of a model of the measures of the rows instead of their features
+const InputMeasures = "measures"
+
+// ConsensusModel is a model with the centroids of the consensus clusters in the input that was clustered
+// It prints how many rows the model assigns to their consensus cluster
+func ConsensusModel(input [][]float64, result *consensus.Result, k int) (*kmeans.Model, error) {
+	centroids, counts := make([]kmeans.Observation, k), make([]int, k)
+	for i := range centroids {
+		centroids[i] = make(kmeans.Observation, len(input[0]))
+	}
+	for row, cluster := range result.Labels {
+		centroids[cluster].Add(input[row])
+		counts[cluster]++
+	}
+	for i := range centroids {
+		if counts[i] == 0 {
+			return nil, fmt.Errorf("consensus cluster %d is empty", i)
+		}
+		centroids[i].Mul(1 / float64(counts[i]))
+	}
+	model, err := kmeans.NewModel(centroids, result.Config.Distance)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := model.PredictBatch(input)
+	if err != nil {
+		return nil, err
+	}
+	agree := 0
+	for row, label := range labels {
+		if label == result.Labels[row] {
+			agree++
+		}
+	}
+	fmt.Println("model agrees with the consensus on", agree, "of", len(labels), "rows")
+	return model, nil
+}
+
+// Predict prints the cluster of each row predicted by a saved k-means model
+// The model predicts from the measures of the rows if it was saved with them
+func Predict(data *Dataset, name string) error {
+	input, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	model, err := kmeans.ReadModel(input)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	features := data.Features
+	if model.Metadata["input"] == InputMeasures {
+		features, err = Measures(rand.New(rand.NewSource(1)), data)
+		if err != nil {
+			return err
+		}
+	}
+	labels, err := model.PredictBatch(features)
+	if err != nil {
+		return err
+	}
+	var memberships [][]float64
+	if *FlagFuzzy != 0 {
+		memberships, err = model.MembershipsBatch(features, *FlagFuzzy)
+		if err != nil {
+			return err
+		}
+	}
+	for row, label := range labels {
+		id := fmt.Sprint(row)
+		if data.IDs != nil {
+			id = data.IDs[row]
+		}
+		if memberships == nil {
+			fmt.Println(id, data.Label(row), label)
+			continue
+		}
+		membership := memberships[row][label]
+		if membership < *FlagConfidence {
+			fmt.Println(id, data.Label(row), label, membership, "low confidence")
+		} else {
+			fmt.Println(id, data.Label(row), label, membership)
+		}
+	}
+	return Score(data, labels)
+}
+
+// Data loads the data set selected by the flags
+func Data() (*Dataset, error) {
+	if *FlagData == "" {
+		return LoadIris()
+	}
+	header, err := ParseHeader(*FlagHeader)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := ParseColumns(*FlagColumns)
+	if err != nil {
+		return nil, err
+	}
+	options := LoadOptions{Header: header, Label: Column(*FlagLabel), ID: Column(*FlagID), Columns: columns}
+	if comma := []rune(*FlagComma); len(comma) == 1 {
+		options.Comma = comma[0]
+	} else if *FlagComma == "\\t" {
+		options.Comma = '\t'
+	} else if len(comma) > 1 {
+		return nil, fmt.Errorf("bad delimiter %q", *FlagComma)
+	}
+	return LoadFile(*FlagData, options)
+}
+
 func main() {
 	flag.Parse()
 
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run runs the mode selected by the flags
+func run() error {
+	if *FlagSelect == "" && (*FlagSave != "" || *FlagModel != "") {
+		return errors.New("-save and -model save the selected k, they need -select")
+	}
+	data, err := Data()
+	if err != nil {
+		return err
+	}
+	if err := data.Validate(); err != nil {
+		return err
+	}
+
+	distance, err := kmeans.Lookup(*FlagDistance)
+	if err != nil {
+		return err
+	}
+	config := consensus.Config{
+		Distance:     *FlagDistance,
+		Init:         *FlagInit,
+		FinisherName: *FlagFinisher,
+		Combiner:     *FlagCombiner,
+		Resamples:    *FlagResamples,
+		Subsample:    *FlagSubsample,
+		Features:     *FlagBagging,
+		Seed:         *FlagSeed,
+		Storage:      *FlagStorage,
+		Threshold:    *FlagThreshold,
+	}
+	if _, err := kmeans.ParseInit(*FlagInit); err != nil {
+		return err
+	}
+
 	if *FlagVariance {
-		VarianceCluster()
-		return
+		return VarianceCluster(data, distance, config)
+	}
+	if *FlagPredict != "" {
+		return Predict(data, *FlagPredict)
 	}
 
 	rng := rand.New(rand.NewSource(1))
-	fisher := Load()
-	vars := make([][]float64, 0, 8)
-	for i := 0; i < 4; i++ {
-		input := NewMatrix(4+i, 150)
-		for i := range fisher {
-			for _, value := range fisher[i].Measures {
-				input.Data = append(input.Data, complex(value, 0))
+	input, err := Measures(rng, data)
+	if err != nil {
+		return err
+	}
+
+	curve := make([]*metrics.Internal, 8)
+	evidence := make([]Evidence, 0, len(curve))
+	results := make([]*consensus.Result, len(curve))
+	for i := 1; i < len(curve) && i <= data.Rows(); i++ {
+		fmt.Println("Cluster", i)
+		result, err := Cluster(data, i, input, config)
+		if err != nil {
+			return err
+		}
+		results[i] = result
+		clusters, coassociation := result.Labels, result.CoAssociation
+		if err := Score(data, clusters); err != nil {
+			return err
+		}
+		if *FlagFuzzy != 0 && i > 1 {
+			if err := Fuzzy(data, i, distance, result); err != nil {
+				return err
 			}
 		}
-		variances := Process(rng, input, fisher)
-		for i := range fisher {
-			fisher[i].Measures = append(fisher[i].Measures, variances[i])
+		e := Evidence{
+			K:       i,
+			Inertia: Inertia(input, clusters),
+			PAC:     PAC(coassociation, PACLower, PACUpper),
+			Area:    Area(coassociation),
+		}
+		if *FlagSelect == SelectGap {
+			e.Gap, e.GapError, err = GapStatistic(rng, input, i, e.Inertia, *FlagReferences)
+			if err != nil {
+				return err
+			}
+		}
+		internal, err := metrics.Validity(input, clusters, kmeans.EuclideanDistance)
+		if err == nil {
+			fmt.Println(internal)
+			curve[i] = internal
+			e.Silhouette = internal.Silhouette
+		} else if !errors.Is(err, metrics.ErrClusters) {
+			return err
+		}
+		evidence = append(evidence, e)
+	}
+	fmt.Println("k silhouette davies-bouldin calinski-harabasz dunn")
+	for i, internal := range curve {
+		if internal != nil {
+			fmt.Println(i, internal.Silhouette, internal.DaviesBouldin, internal.CalinskiHarabasz, internal.Dunn)
 		}
-		vars = append(vars, variances)
 	}
 
-	for i := 1; i < 8; i++ {
-		fmt.Println("Cluster", i)
-		clusters := Cluster(i, vars)
-		Entropy(fisher, i, clusters)
+	if *FlagSelect == "" {
+		return nil
+	}
+	Deltas(evidence)
+	fmt.Println("k inertia silhouette gap gap_error pac area delta")
+	for _, e := range evidence {
+		fmt.Println(e.K, e.Inertia, e.Silhouette, e.Gap, e.GapError, e.PAC, e.Area, e.Delta)
+	}
+	k, err := SelectK(*FlagSelect, evidence)
+	if err != nil {
+		return err
+	}
+	fmt.Println("selected k", k, "by", *FlagSelect)
+	if *FlagSave != "" {
+		if err := Save(*FlagSave, results[k]); err != nil {
+			return err
+		}
+	}
+	if *FlagModel != "" {
+		model, err := ConsensusModel(input, results[k], k)
+		if err != nil {
+			return err
+		}
+		model.Metadata = map[string]string{
+			"input":    InputMeasures,
+			"selected": *FlagSelect,
+		}
+		if err := Save(*FlagModel, model); err != nil {
+			return err
+		}
 	}
+	return nil
 }
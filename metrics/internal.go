@@ -0,0 +1,267 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/pointlander/ultra/kmeans"
+)
+
+// ErrClusters means the number of clusters is out of range for the index
+var ErrClusters = errors.New("need at least 2 clusters and fewer clusters than rows")
+
+// groups returns the rows in each cluster
+func groups(data [][]float64, labels []int) ([][]int, error) {
+	if len(data) != len(labels) {
+		return nil, ErrLength
+	}
+	if len(data) == 0 {
+		return nil, ErrEmpty
+	}
+	mapped, k := dense(labels)
+	if k < 2 || k >= len(data) {
+		return nil, ErrClusters
+	}
+	members := make([][]int, k)
+	for i, cluster := range mapped {
+		members[cluster] = append(members[cluster], i)
+	}
+	return members, nil
+}
+
+// centroids computes the mean of each cluster
+func centroids(data [][]float64, members [][]int) [][]float64 {
+	means := make([][]float64, len(members))
+	for i, rows := range members {
+		means[i] = make([]float64, len(data[0]))
+		for _, row := range rows {
+			for j, value := range data[row] {
+				means[i][j] += value
+			}
+		}
+		for j := range means[i] {
+			means[i][j] /= float64(len(rows))
+		}
+	}
+	return means
+}
+
+// silhouette is the silhouette of row i
+func silhouette(data [][]float64, members [][]int, cluster []int, i int, distance kmeans.DistanceFunction) (float64, error) {
+	own := cluster[i]
+	if len(members[own]) == 1 {
+		return 0, nil
+	}
+	a, b := 0.0, math.Inf(1)
+	for c, rows := range members {
+		sum := 0.0
+		for _, j := range rows {
+			if j == i {
+				continue
+			}
+			d, err := distance(data[i], data[j])
+			if err != nil {
+				return 0, err
+			}
+			sum += d
+		}
+		if c == own {
+			a = sum / float64(len(rows)-1)
+		} else if mean := sum / float64(len(rows)); mean < b {
+			b = mean
+		}
+	}
+	if max := math.Max(a, b); max > 0 {
+		return (b - a) / max, nil
+	}
+	return 0, nil
+}
+
+// Silhouette computes the mean silhouette and the silhouette of each row
+func Silhouette(data [][]float64, labels []int, distance kmeans.DistanceFunction) (float64, []float64, error) {
+	members, err := groups(data, labels)
+	if err != nil {
+		return 0, nil, err
+	}
+	cluster, _ := dense(labels)
+	values, sum := make([]float64, len(data)), 0.0
+	for i := range data {
+		s, err := silhouette(data, members, cluster, i, distance)
+		if err != nil {
+			return 0, nil, err
+		}
+		values[i] = s
+		sum += s
+	}
+	return sum / float64(len(data)), values, nil
+}
+
+// SampledSilhouette estimates the mean silhouette from a random sample of rows
+func SampledSilhouette(rng *rand.Rand, data [][]float64, labels []int, distance kmeans.DistanceFunction, samples int) (float64, error) {
+	members, err := groups(data, labels)
+	if err != nil {
+		return 0, err
+	}
+	if samples <= 0 || samples > len(data) {
+		samples = len(data)
+	}
+	cluster, _ := dense(labels)
+	sum := 0.0
+	for _, i := range rng.Perm(len(data))[:samples] {
+		s, err := silhouette(data, members, cluster, i, distance)
+		if err != nil {
+			return 0, err
+		}
+		sum += s
+	}
+	return sum / float64(samples), nil
+}
+
+// DaviesBouldin computes the Davies-Bouldin index, lower is better
+func DaviesBouldin(data [][]float64, labels []int, distance kmeans.DistanceFunction) (float64, error) {
+	members, err := groups(data, labels)
+	if err != nil {
+		return 0, err
+	}
+	means := centroids(data, members)
+	scatter := make([]float64, len(members))
+	for i, rows := range members {
+		for _, row := range rows {
+			d, err := distance(data[row], means[i])
+			if err != nil {
+				return 0, err
+			}
+			scatter[i] += d
+		}
+		scatter[i] /= float64(len(rows))
+	}
+	index := 0.0
+	for i := range members {
+		max := 0.0
+		for j := range members {
+			if i == j {
+				continue
+			}
+			d, err := distance(means[i], means[j])
+			if err != nil {
+				return 0, err
+			}
+			ratio := math.Inf(1)
+			if d > 0 {
+				ratio = (scatter[i] + scatter[j]) / d
+			}
+			if ratio > max {
+				max = ratio
+			}
+		}
+		index += max
+	}
+	return index / float64(len(members)), nil
+}
+
+// CalinskiHarabasz computes the variance ratio criterion, higher is better
+func CalinskiHarabasz(data [][]float64, labels []int) (float64, error) {
+	members, err := groups(data, labels)
+	if err != nil {
+		return 0, err
+	}
+	means := centroids(data, members)
+	all := make([]float64, len(data[0]))
+	for _, row := range data {
+		for j, value := range row {
+			all[j] += value
+		}
+	}
+	for j := range all {
+		all[j] /= float64(len(data))
+	}
+	between, within := 0.0, 0.0
+	for i, rows := range members {
+		for j, value := range means[i] {
+			diff := value - all[j]
+			between += float64(len(rows)) * diff * diff
+		}
+		for _, row := range rows {
+			for j, value := range data[row] {
+				diff := value - means[i][j]
+				within += diff * diff
+			}
+		}
+	}
+	if within == 0 {
+		return math.Inf(1), nil
+	}
+	n, k := float64(len(data)), float64(len(members))
+	return between * (n - k) / (within * (k - 1)), nil
+}
+
+// Dunn computes the Dunn index, the smallest distance between clusters over the largest cluster diameter
+func Dunn(data [][]float64, labels []int, distance kmeans.DistanceFunction) (float64, error) {
+	if _, err := groups(data, labels); err != nil {
+		return 0, err
+	}
+	separation, diameter := math.Inf(1), 0.0
+	for i := range data {
+		for j := i + 1; j < len(data); j++ {
+			d, err := distance(data[i], data[j])
+			if err != nil {
+				return 0, err
+			}
+			if labels[i] == labels[j] {
+				if d > diameter {
+					diameter = d
+				}
+			} else if d < separation {
+				separation = d
+			}
+		}
+	}
+	if diameter == 0 {
+		return math.Inf(1), nil
+	}
+	return separation / diameter, nil
+}
+
+// Internal are internal validation scores of a clustering computed without ground truth
+type Internal struct {
+	Silhouette       float64
+	DaviesBouldin    float64
+	CalinskiHarabasz float64
+	Dunn             float64
+}
+
+// Validity computes the internal validation scores of a clustering
+func Validity(data [][]float64, labels []int, distance kmeans.DistanceFunction) (*Internal, error) {
+	var (
+		internal Internal
+		err      error
+	)
+	internal.Silhouette, _, err = Silhouette(data, labels, distance)
+	if err != nil {
+		return nil, err
+	}
+	internal.DaviesBouldin, err = DaviesBouldin(data, labels, distance)
+	if err != nil {
+		return nil, err
+	}
+	internal.CalinskiHarabasz, err = CalinskiHarabasz(data, labels)
+	if err != nil {
+		return nil, err
+	}
+	internal.Dunn, err = Dunn(data, labels, distance)
+	if err != nil {
+		return nil, err
+	}
+	return &internal, nil
+}
+
+func (i *Internal) String() string {
+	return fmt.Sprintf("silhouette=%.4f davies-bouldin=%.4f calinski-harabasz=%.4f dunn=%.4f",
+		i.Silhouette, i.DaviesBouldin, i.CalinskiHarabasz, i.Dunn)
+}
@@ -0,0 +1,128 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/pointlander/ultra/kmeans"
+)
+
+// Two pairs of points on a line, {0, 1} and {4, 5}
+//
+// silhouette: rows 0 and 3 are (4.5-1)/4.5, rows 1 and 2 are (3.5-1)/3.5
+// davies-bouldin: both scatters are 0.5 and the centroids are 4 apart, (0.5+0.5)/4
+// calinski-harabasz: between is 2*2^2+2*2^2 = 16, within is 4*0.5^2 = 1, 16*(4-2)/(1*(2-1))
+// dunn: the closest rows in different clusters are 3 apart and the widest cluster is 1 across
+func TestValidity(t *testing.T) {
+	data := [][]float64{{0}, {1}, {4}, {5}}
+	labels := []int{0, 0, 1, 1}
+	internal, err := Validity(data, labels, kmeans.EuclideanDistance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	silhouette := (3.5/4.5 + 2.5/3.5) / 2
+	if !approx(internal.Silhouette, silhouette) {
+		t.Errorf("silhouette %f, want %f", internal.Silhouette, silhouette)
+	}
+	if !approx(internal.DaviesBouldin, 0.25) {
+		t.Errorf("davies-bouldin %f, want 0.25", internal.DaviesBouldin)
+	}
+	if !approx(internal.CalinskiHarabasz, 32) {
+		t.Errorf("calinski-harabasz %f, want 32", internal.CalinskiHarabasz)
+	}
+	if !approx(internal.Dunn, 3) {
+		t.Errorf("dunn %f, want 3", internal.Dunn)
+	}
+
+	sampled, err := SampledSilhouette(rand.New(rand.NewSource(1)), data, labels, kmeans.EuclideanDistance, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !approx(sampled, silhouette) {
+		t.Errorf("sampled silhouette over every row %f, want %f", sampled, silhouette)
+	}
+}
+
+// A singleton cluster has a silhouette of 0 and no scatter
+func TestSingleton(t *testing.T) {
+	data := [][]float64{{0}, {1}, {10}}
+	labels := []int{0, 0, 1}
+	mean, values, err := Silhouette(data, labels, kmeans.EuclideanDistance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{0.9, 8. / 9, 0}
+	for i := range want {
+		if !approx(values[i], want[i]) {
+			t.Errorf("silhouette of row %d is %f, want %f", i, values[i], want[i])
+		}
+	}
+	if !approx(mean, (0.9+8./9)/3) {
+		t.Errorf("mean silhouette %f, want %f", mean, (0.9+8./9)/3)
+	}
+	index, err := DaviesBouldin(data, labels, kmeans.EuclideanDistance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !approx(index, 0.5/9.5) {
+		t.Errorf("davies-bouldin %f, want %f", index, 0.5/9.5)
+	}
+	dunn, err := Dunn(data, labels, kmeans.EuclideanDistance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !approx(dunn, 9) {
+		t.Errorf("dunn %f, want 9", dunn)
+	}
+}
+
+// Clusters without spread have no within cluster variance or diameter
+func TestCompact(t *testing.T) {
+	data := [][]float64{{0}, {0}, {3}, {3}}
+	labels := []int{0, 0, 1, 1}
+	ch, err := CalinskiHarabasz(data, labels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsInf(ch, 1) {
+		t.Errorf("calinski-harabasz %f, want +Inf", ch)
+	}
+	dunn, err := Dunn(data, labels, kmeans.EuclideanDistance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsInf(dunn, 1) {
+		t.Errorf("dunn %f, want +Inf", dunn)
+	}
+	mean, _, err := Silhouette(data, labels, kmeans.EuclideanDistance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !approx(mean, 1) {
+		t.Errorf("silhouette %f, want 1", mean)
+	}
+}
+
+// The indexes are undefined for one cluster and for a cluster per row
+func TestClusters(t *testing.T) {
+	data := [][]float64{{0}, {1}, {4}}
+	for _, labels := range [][]int{{0, 0, 0}, {0, 1, 2}} {
+		if _, err := Validity(data, labels, kmeans.EuclideanDistance); err != ErrClusters {
+			t.Errorf("labels %v got %v, want ErrClusters", labels, err)
+		}
+		if _, err := CalinskiHarabasz(data, labels); err != ErrClusters {
+			t.Errorf("labels %v got %v, want ErrClusters", labels, err)
+		}
+	}
+	if _, err := Validity(data, []int{0, 1}, kmeans.EuclideanDistance); err != ErrLength {
+		t.Errorf("got %v, want ErrLength", err)
+	}
+	if _, err := Validity(nil, nil, kmeans.EuclideanDistance); err != ErrEmpty {
+		t.Errorf("got %v, want ErrEmpty", err)
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package metrics scores clusterings
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	// ErrEmpty means there are no labels to compare
+	ErrEmpty = errors.New("no labels")
+	// ErrLength means the labelings have different lengths
+	ErrLength = errors.New("labelings have different lengths")
+)
+
+// Contingency is the contingency table of two labelings
+type Contingency struct {
+	// Table counts the rows in each class (row) and cluster (column)
+	Table [][]int
+	// Classes are the number of rows in each class
+	Classes []int
+	// Clusters are the number of rows in each cluster
+	Clusters []int
+	// N is the number of rows
+	N int
+}
+
+// dense maps labels to consecutive integers in order of appearance
+func dense(labels []int) ([]int, int) {
+	index := make(map[int]int)
+	mapped := make([]int, len(labels))
+	for i, label := range labels {
+		value, ok := index[label]
+		if !ok {
+			value = len(index)
+			index[label] = value
+		}
+		mapped[i] = value
+	}
+	return mapped, len(index)
+}
+
+// NewContingency computes the contingency table of the ground truth classes and the clusters
+func NewContingency(classes, clusters []int) (*Contingency, error) {
+	if len(classes) != len(clusters) {
+		return nil, ErrLength
+	}
+	if len(classes) == 0 {
+		return nil, ErrEmpty
+	}
+	a, rows := dense(classes)
+	b, cols := dense(clusters)
+	c := &Contingency{
+		Table:    make([][]int, rows),
+		Classes:  make([]int, rows),
+		Clusters: make([]int, cols),
+		N:        len(classes),
+	}
+	for i := range c.Table {
+		c.Table[i] = make([]int, cols)
+	}
+	for i := range a {
+		c.Table[a[i]][b[i]]++
+		c.Classes[a[i]]++
+		c.Clusters[b[i]]++
+	}
+	return c, nil
+}
+
+// comb2 is n choose 2
+func comb2(n int) float64 {
+	return float64(n) * float64(n-1) / 2
+}
+
+// entropy is the entropy of a set of counts
+func entropy(counts []int, n int) float64 {
+	h := 0.0
+	for _, count := range counts {
+		if count > 0 {
+			p := float64(count) / float64(n)
+			h -= p * math.Log(p)
+		}
+	}
+	return h
+}
+
+// Entropy is the entropy of the classes and the clusters
+func (c *Contingency) Entropy() (classes, clusters float64) {
+	return entropy(c.Classes, c.N), entropy(c.Clusters, c.N)
+}
+
+// MutualInformation is the mutual information between the classes and the clusters
+func (c *Contingency) MutualInformation() float64 {
+	mi, n := 0.0, float64(c.N)
+	for i, row := range c.Table {
+		for j, count := range row {
+			if count > 0 {
+				nij := float64(count)
+				mi += nij / n * math.Log(n*nij/(float64(c.Classes[i])*float64(c.Clusters[j])))
+			}
+		}
+	}
+	return math.Max(mi, 0)
+}
+
+// ExpectedMutualInformation is the expected mutual information under the hypergeometric model
+func (c *Contingency) ExpectedMutualInformation() float64 {
+	n := float64(c.N)
+	lgamma := func(x float64) float64 {
+		value, _ := math.Lgamma(x + 1)
+		return value
+	}
+	emi, lgn := 0.0, lgamma(n)
+	for _, ai := range c.Classes {
+		a := float64(ai)
+		for _, bj := range c.Clusters {
+			b := float64(bj)
+			start := math.Max(1, a+b-n)
+			end := math.Min(a, b)
+			base := lgamma(a) + lgamma(b) + lgamma(n-a) + lgamma(n-b) - lgn
+			for nij := start; nij <= end; nij++ {
+				term := nij / n * math.Log(n*nij/(a*b))
+				p := base - lgamma(nij) - lgamma(a-nij) - lgamma(b-nij) - lgamma(n-a-b+nij)
+				emi += term * math.Exp(p)
+			}
+		}
+	}
+	return emi
+}
+
+// AdjustedRandIndex is the rand index adjusted for chance
+func (c *Contingency) AdjustedRandIndex() float64 {
+	// a single cluster or all singletons in both labelings is a perfect match with no pairs to compare
+	if classes, clusters := len(c.Classes), len(c.Clusters); classes == clusters && (classes == 1 || classes == c.N) {
+		return 1
+	}
+	index, sumA, sumB := 0.0, 0.0, 0.0
+	for _, row := range c.Table {
+		for _, count := range row {
+			index += comb2(count)
+		}
+	}
+	for _, count := range c.Classes {
+		sumA += comb2(count)
+	}
+	for _, count := range c.Clusters {
+		sumB += comb2(count)
+	}
+	expected := sumA * sumB / comb2(c.N)
+	maximum := (sumA + sumB) / 2
+	if maximum == expected {
+		return 1
+	}
+	return (index - expected) / (maximum - expected)
+}
+
+// NormalizedMutualInformation is the mutual information normalized by the mean entropy
+func (c *Contingency) NormalizedMutualInformation() float64 {
+	ha, hb := c.Entropy()
+	if ha == 0 && hb == 0 {
+		return 1
+	}
+	return c.MutualInformation() / ((ha + hb) / 2)
+}
+
+// AdjustedMutualInformation is the mutual information adjusted for chance
+func (c *Contingency) AdjustedMutualInformation() float64 {
+	ha, hb := c.Entropy()
+	if ha == 0 && hb == 0 {
+		return 1
+	}
+	emi := c.ExpectedMutualInformation()
+	denominator := (ha+hb)/2 - emi
+	if denominator == 0 {
+		return 0
+	}
+	return (c.MutualInformation() - emi) / denominator
+}
+
+// VMeasure is the homogeneity, completeness and their harmonic mean
+func (c *Contingency) VMeasure() (homogeneity, completeness, v float64) {
+	ha, hb := c.Entropy()
+	mi := c.MutualInformation()
+	homogeneity, completeness = 1, 1
+	if ha > 0 {
+		homogeneity = mi / ha
+	}
+	if hb > 0 {
+		completeness = mi / hb
+	}
+	if homogeneity+completeness > 0 {
+		v = 2 * homogeneity * completeness / (homogeneity + completeness)
+	}
+	return homogeneity, completeness, v
+}
+
+// FowlkesMallows is the geometric mean of the pairwise precision and recall
+func (c *Contingency) FowlkesMallows() float64 {
+	tk, pk, qk := 0.0, 0.0, 0.0
+	for _, row := range c.Table {
+		for _, count := range row {
+			tk += float64(count) * float64(count)
+		}
+	}
+	for _, count := range c.Classes {
+		qk += float64(count) * float64(count)
+	}
+	for _, count := range c.Clusters {
+		pk += float64(count) * float64(count)
+	}
+	n := float64(c.N)
+	tk, pk, qk = tk-n, pk-n, qk-n
+	if tk == 0 {
+		return 0
+	}
+	return tk / math.Sqrt(pk*qk)
+}
+
+// Purity is the fraction of rows in the majority class of their cluster
+func (c *Contingency) Purity() float64 {
+	sum := 0
+	for j := range c.Clusters {
+		max := 0
+		for i := range c.Table {
+			if c.Table[i][j] > max {
+				max = c.Table[i][j]
+			}
+		}
+		sum += max
+	}
+	return float64(sum) / float64(c.N)
+}
+
+// External are external validation scores of a clustering against ground truth
+type External struct {
+	Contingency    *Contingency
+	ARI            float64
+	NMI            float64
+	AMI            float64
+	Homogeneity    float64
+	Completeness   float64
+	VMeasure       float64
+	FowlkesMallows float64
+	Purity         float64
+}
+
+// Compare scores the clusters against the ground truth classes
+func Compare(classes, clusters []int) (*External, error) {
+	c, err := NewContingency(classes, clusters)
+	if err != nil {
+		return nil, err
+	}
+	external := &External{
+		Contingency:    c,
+		ARI:            c.AdjustedRandIndex(),
+		NMI:            c.NormalizedMutualInformation(),
+		AMI:            c.AdjustedMutualInformation(),
+		FowlkesMallows: c.FowlkesMallows(),
+		Purity:         c.Purity(),
+	}
+	external.Homogeneity, external.Completeness, external.VMeasure = c.VMeasure()
+	return external, nil
+}
+
+func (e *External) String() string {
+	return fmt.Sprintf("ari=%.4f nmi=%.4f ami=%.4f homogeneity=%.4f completeness=%.4f v=%.4f fmi=%.4f purity=%.4f",
+		e.ARI, e.NMI, e.AMI, e.Homogeneity, e.Completeness, e.VMeasure, e.FowlkesMallows, e.Purity)
+}
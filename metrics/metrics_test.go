@@ -0,0 +1,121 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+// approx reports whether a and b agree to the precision of the reference values
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-5
+}
+
+// contingency builds the contingency table or fails the test
+func contingency(t *testing.T, classes, clusters []int) *Contingency {
+	t.Helper()
+	c, err := NewContingency(classes, clusters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// The reference values are the outputs of scikit-learn for the same labelings
+func TestReference(t *testing.T) {
+	classes := []int{1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 2, 2, 3, 3, 3, 3, 3}
+	clusters := []int{1, 1, 1, 1, 2, 1, 2, 2, 2, 2, 3, 1, 3, 3, 3, 2, 2}
+	c := contingency(t, classes, clusters)
+	if mi := c.MutualInformation(); !approx(mi, 0.41022) {
+		t.Errorf("mutual information %f, want 0.41022", mi)
+	}
+	if emi := c.ExpectedMutualInformation(); !approx(emi, 0.15042) {
+		t.Errorf("expected mutual information %f, want 0.15042", emi)
+	}
+	if ami := c.AdjustedMutualInformation(); !approx(ami, 0.27821) {
+		t.Errorf("adjusted mutual information %f, want 0.27821", ami)
+	}
+	if nmi := c.NormalizedMutualInformation(); !approx(nmi, 0.37835) {
+		t.Errorf("normalized mutual information %f, want 0.37835", nmi)
+	}
+}
+
+func TestAdjustedRandIndex(t *testing.T) {
+	tests := []struct {
+		classes, clusters []int
+		want              float64
+	}{
+		{[]int{0, 0, 1, 1}, []int{0, 0, 1, 1}, 1},
+		{[]int{0, 0, 1, 1}, []int{1, 1, 0, 0}, 1},
+		{[]int{0, 0, 1, 2}, []int{0, 0, 1, 1}, 4. / 7},
+		{[]int{0, 0, 1, 1}, []int{0, 1, 0, 1}, -0.5},
+		{[]int{0, 0, 0, 0}, []int{0, 1, 2, 3}, 0},
+		{[]int{0, 1, 2, 3}, []int{3, 2, 1, 0}, 1},
+		{[]int{0}, []int{0}, 1},
+		{[]int{0, 0, 0}, []int{1, 1, 1}, 1},
+	}
+	for _, test := range tests {
+		ari := contingency(t, test.classes, test.clusters).AdjustedRandIndex()
+		if !approx(ari, test.want) {
+			t.Errorf("ari of %v and %v is %f, want %f", test.classes, test.clusters, ari, test.want)
+		}
+	}
+}
+
+func TestVMeasure(t *testing.T) {
+	homogeneity, completeness, v := contingency(t, []int{0, 0, 1, 2}, []int{0, 0, 1, 1}).VMeasure()
+	if !approx(homogeneity, 2./3) || !approx(completeness, 1) || !approx(v, 0.8) {
+		t.Errorf("v-measure (%f, %f, %f), want (0.66667, 1, 0.8)", homogeneity, completeness, v)
+	}
+	homogeneity, completeness, v = contingency(t, []int{0, 0, 1, 1}, []int{0, 0, 1, 2}).VMeasure()
+	if !approx(homogeneity, 1) || !approx(completeness, 2./3) || !approx(v, 0.8) {
+		t.Errorf("v-measure (%f, %f, %f), want (1, 0.66667, 0.8)", homogeneity, completeness, v)
+	}
+}
+
+func TestFowlkesMallows(t *testing.T) {
+	tests := []struct {
+		classes, clusters []int
+		want              float64
+	}{
+		{[]int{0, 0, 1, 1}, []int{0, 0, 1, 1}, 1},
+		{[]int{0, 0, 0, 0}, []int{0, 1, 2, 3}, 0},
+		{[]int{0, 0, 0, 1, 1, 1}, []int{0, 0, 1, 1, 2, 2}, 4 / math.Sqrt(72)},
+	}
+	for _, test := range tests {
+		fmi := contingency(t, test.classes, test.clusters).FowlkesMallows()
+		if !approx(fmi, test.want) {
+			t.Errorf("fmi of %v and %v is %f, want %f", test.classes, test.clusters, fmi, test.want)
+		}
+	}
+}
+
+func TestPurity(t *testing.T) {
+	purity := contingency(t, []int{0, 0, 0, 1, 1, 1}, []int{0, 0, 1, 1, 2, 2}).Purity()
+	if !approx(purity, 5./6) {
+		t.Errorf("purity %f, want 0.83333", purity)
+	}
+}
+
+func TestCompareDegenerate(t *testing.T) {
+	external, err := Compare([]int{7}, []int{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, score := range map[string]float64{
+		"ari": external.ARI, "nmi": external.NMI, "ami": external.AMI, "v": external.VMeasure, "purity": external.Purity,
+	} {
+		if score != 1 {
+			t.Errorf("%s of a single row is %f, want 1", name, score)
+		}
+	}
+	if _, err := Compare([]int{0, 1}, []int{0}); err != ErrLength {
+		t.Errorf("got %v, want ErrLength", err)
+	}
+	if _, err := Compare(nil, nil); err != ErrEmpty {
+		t.Errorf("got %v, want ErrEmpty", err)
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/pointlander/ultra/consensus"
+	"github.com/pointlander/ultra/kmeans"
+)
+
+const (
+	// SelectGap selects k with the gap statistic
+	SelectGap = "gap"
+	// SelectElbow selects k at the elbow of the inertia curve
+	SelectElbow = "elbow"
+	// SelectSilhouette selects k with the best silhouette
+	SelectSilhouette = "silhouette"
+	// SelectPAC selects k with the lowest proportion of ambiguous clustering
+	SelectPAC = "pac"
+	// SelectDelta selects k where the consensus CDF area stops growing
+	SelectDelta = "delta"
+)
+
+const (
+	// PACLower is the lower bound of an ambiguous consensus value
+	PACLower = 0.1
+	// PACUpper is the upper bound of an ambiguous consensus value
+	PACUpper = 0.9
+	// DeltaThreshold is the relative area increase below which more clusters don't help
+	DeltaThreshold = 0.1
+)
+
+// Evidence is the evidence for selecting k
+type Evidence struct {
+	K          int
+	Inertia    float64
+	Silhouette float64
+	Gap        float64
+	GapError   float64
+	PAC        float64
+	Area       float64
+	Delta      float64
+}
+
+// Inertia is the within cluster sum of squared distances to the cluster means
+func Inertia(features [][]float64, clusters []int) float64 {
+	sums, counts := make(map[int][]float64), make(map[int]float64)
+	for i, row := range features {
+		sum := sums[clusters[i]]
+		if sum == nil {
+			sum = make([]float64, len(row))
+			sums[clusters[i]] = sum
+		}
+		for j, value := range row {
+			sum[j] += value
+		}
+		counts[clusters[i]]++
+	}
+	inertia := 0.0
+	for i, row := range features {
+		sum, count := sums[clusters[i]], counts[clusters[i]]
+		for j, value := range row {
+			diff := value - sum[j]/count
+			inertia += diff * diff
+		}
+	}
+	return inertia
+}
+
+// logInertia is the log of an inertia, a zero inertia is clamped to the smallest positive float
+func logInertia(inertia float64) float64 {
+	return math.Log(math.Max(inertia, math.SmallestNonzeroFloat64))
+}
+
+// GapStatistic compares the log inertia to its expectation under uniform reference data
+func GapStatistic(rng *rand.Rand, features [][]float64, k int, inertia float64, references int) (float64, float64, error) {
+	width := len(features[0])
+	min, max := make([]float64, width), make([]float64, width)
+	copy(min, features[0])
+	copy(max, features[0])
+	for _, row := range features {
+		for j, value := range row {
+			min[j] = math.Min(min[j], value)
+			max[j] = math.Max(max[j], value)
+		}
+	}
+	logs := make([]float64, references)
+	for b := range logs {
+		reference := make([][]float64, len(features))
+		for i := range reference {
+			reference[i] = make([]float64, width)
+			for j := range reference[i] {
+				reference[i][j] = min[j] + rng.Float64()*(max[j]-min[j])
+			}
+		}
+		options := kmeans.Options{Seed: rng.Int63(), Workers: 1, Squared: true}
+		result, err := kmeans.Fit(reference, k, kmeans.SquaredEuclideanDistance, options)
+		if err != nil {
+			return 0, 0, err
+		}
+		logs[b] = logInertia(result.Inertia)
+	}
+	mean := 0.0
+	for _, value := range logs {
+		mean += value
+	}
+	mean /= float64(references)
+	variance := 0.0
+	for _, value := range logs {
+		diff := value - mean
+		variance += diff * diff
+	}
+	variance /= float64(references)
+	return mean - logInertia(inertia), math.Sqrt(variance) * math.Sqrt(1+1/float64(references)), nil
+}
+
+// PAC is the proportion of pairs with an ambiguous consensus value
+func PAC(coassociation consensus.Matrix, lower, upper float64) float64 {
+	n := coassociation.Len()
+	pairs, ambiguous := n*(n-1)/2, 0
+	for i := 0; i < n; i++ {
+		coassociation.Row(i, func(j int, value float64) {
+			if j > i && value > lower && value < upper {
+				ambiguous++
+			}
+		})
+	}
+	if pairs == 0 {
+		return 0
+	}
+	return float64(ambiguous) / float64(pairs)
+}
+
+// Area is the area under the empirical CDF of the consensus values
+func Area(coassociation consensus.Matrix) float64 {
+	n := coassociation.Len()
+	pairs := n * (n - 1) / 2
+	if pairs == 0 {
+		return 0
+	}
+	values := make([]float64, 0, 8)
+	for i := 0; i < n; i++ {
+		coassociation.Row(i, func(j int, value float64) {
+			if j > i && value > 0 {
+				values = append(values, value)
+			}
+		})
+	}
+	sort.Float64s(values)
+	// the pairs that are not stored have zero consensus
+	zeros := pairs - len(values)
+	area, previous := 0.0, 0.0
+	for i, value := range values {
+		area += (value - previous) * float64(zeros+i) / float64(pairs)
+		previous = value
+	}
+	return area
+}
+
+// Elbow finds the point of the curve farthest from the line between its ends
+func Elbow(x, y []float64) int {
+	last := len(x) - 1
+	if last < 2 {
+		return 0
+	}
+	dx, dy := x[last]-x[0], y[last]-y[0]
+	norm := math.Sqrt(dx*dx + dy*dy)
+	if norm == 0 {
+		return 0
+	}
+	index, max := 0, 0.0
+	for i := range x {
+		distance := math.Abs(dy*(x[i]-x[0])-dx*(y[i]-y[0])) / norm
+		if distance > max {
+			index, max = i, distance
+		}
+	}
+	return index
+}
+
+// SelectK selects k from the evidence with the given method
+func SelectK(method string, evidence []Evidence) (int, error) {
+	if len(evidence) == 0 {
+		return 0, fmt.Errorf("no evidence")
+	}
+	switch method {
+	case SelectGap:
+		for i := 0; i+1 < len(evidence); i++ {
+			next := evidence[i+1]
+			if evidence[i].Gap >= next.Gap-next.GapError {
+				return evidence[i].K, nil
+			}
+		}
+		return evidence[len(evidence)-1].K, nil
+	case SelectElbow:
+		x, y := make([]float64, len(evidence)), make([]float64, len(evidence))
+		for i, e := range evidence {
+			x[i], y[i] = float64(e.K), e.Inertia
+		}
+		return evidence[Elbow(x, y)].K, nil
+	case SelectSilhouette, SelectPAC:
+		k, best := 0, math.Inf(-1)
+		for _, e := range evidence {
+			if e.K < 2 {
+				continue
+			}
+			score := e.Silhouette
+			if method == SelectPAC {
+				score = -e.PAC
+			}
+			if score > best {
+				k, best = e.K, score
+			}
+		}
+		if k == 0 {
+			return 0, fmt.Errorf("%s needs at least 2 clusters", method)
+		}
+		return k, nil
+	case SelectDelta:
+		for i, e := range evidence {
+			if e.K < 2 {
+				continue
+			}
+			if i+1 == len(evidence) || evidence[i+1].Delta < DeltaThreshold {
+				return e.K, nil
+			}
+		}
+		return 0, fmt.Errorf("%s needs at least 2 clusters", method)
+	}
+	return 0, fmt.Errorf("unknown selection method %q", method)
+}
+
+// Deltas computes the relative increase in consensus CDF area with each k
+func Deltas(evidence []Evidence) {
+	for i := range evidence {
+		if evidence[i].K < 2 {
+			continue
+		}
+		if i == 0 || evidence[i-1].K < 2 || evidence[i-1].Area == 0 {
+			evidence[i].Delta = evidence[i].Area
+			continue
+		}
+		evidence[i].Delta = (evidence[i].Area - evidence[i-1].Area) / evidence[i-1].Area
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 The Ultra Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/pointlander/ultra/consensus"
+)
+
+func TestPACArea(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		labelings [][]int
+		pac, area float64
+	}{
+		// pairs (0, 1) and (1, 2) are together half the time, (0, 2) never
+		{"ambiguous", [][]int{{0, 0, 1}, {0, 1, 1}}, 2. / 3, 1. / 6},
+		// pair (0, 1) is always together, the others never
+		{"clean", [][]int{{0, 0, 1}, {1, 1, 0}}, 0, 2. / 3},
+		{"single row", [][]int{{0}}, 0, 0},
+	} {
+		coassociation, err := consensus.CoAssociation(test.labelings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pac := PAC(coassociation, PACLower, PACUpper); math.Abs(pac-test.pac) > 1e-12 {
+			t.Errorf("%s: pac %f, want %f", test.name, pac, test.pac)
+		}
+		if area := Area(coassociation); math.Abs(area-test.area) > 1e-12 {
+			t.Errorf("%s: area %f, want %f", test.name, area, test.area)
+		}
+	}
+}
+
+func TestDeltas(t *testing.T) {
+	evidence := []Evidence{{K: 1}, {K: 2, Area: 0.2}, {K: 3, Area: 0.3}, {K: 4, Area: 0.33}, {K: 5, Area: 0.33}}
+	Deltas(evidence)
+	for i, want := range []float64{0, 0.2, 0.5, 0.1, 0} {
+		if math.Abs(evidence[i].Delta-want) > 1e-12 {
+			t.Errorf("k=%d delta %f, want %f", evidence[i].K, evidence[i].Delta, want)
+		}
+	}
+}
+
+func TestSelectK(t *testing.T) {
+	evidence := []Evidence{
+		{K: 1, Inertia: 100, Gap: 0.1, GapError: 0.05, Delta: 0},
+		{K: 2, Inertia: 20, Silhouette: 0.6, Gap: 0.8, GapError: 0.05, PAC: 0.3, Delta: 0.5},
+		{K: 3, Inertia: 12, Silhouette: 0.7, Gap: 0.82, GapError: 0.05, PAC: 0.1, Delta: 0.3},
+		{K: 4, Inertia: 10, Silhouette: 0.5, Gap: 0.83, GapError: 0.05, PAC: 0.2, Delta: 0.05},
+		{K: 5, Inertia: 9, Silhouette: 0.4, Gap: 0.84, GapError: 0.05, PAC: 0.25, Delta: 0.01},
+	}
+	for _, test := range []struct {
+		method string
+		k      int
+	}{
+		// the first k with a gap within an error of the next
+		{SelectGap, 2},
+		{SelectElbow, 2},
+		{SelectSilhouette, 3},
+		{SelectPAC, 3},
+		// the last k before the area stops growing by the threshold
+		{SelectDelta, 3},
+	} {
+		k, err := SelectK(test.method, evidence)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k != test.k {
+			t.Errorf("%s selected k=%d, want %d", test.method, k, test.k)
+		}
+	}
+	for _, test := range []struct {
+		method   string
+		evidence []Evidence
+	}{
+		{SelectGap, nil},
+		{"unknown", evidence},
+		{SelectSilhouette, evidence[:1]},
+		{SelectPAC, evidence[:1]},
+		{SelectDelta, evidence[:1]},
+	} {
+		if _, err := SelectK(test.method, test.evidence); err == nil {
+			t.Errorf("%s with %d evidence has no error", test.method, len(test.evidence))
+		}
+	}
+}
+
+// Two tight clusters at opposite corners have their largest gap at k=2
+func TestGapStatistic(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	features := make([][]float64, 40)
+	clusters := make([][]int, 4)
+	for i := range features {
+		corner := float64(i%2) * 10
+		features[i] = []float64{corner + 0.1*rng.NormFloat64(), corner + 0.1*rng.NormFloat64()}
+		for k := range clusters {
+			clusters[k] = append(clusters[k], i%(k+1))
+		}
+	}
+	evidence := make([]Evidence, len(clusters))
+	for i, labels := range clusters {
+		k := i + 1
+		// the labels of k=3 and k=4 split the corners arbitrarily, which only makes their gap smaller
+		evidence[i] = Evidence{K: k, Inertia: Inertia(features, labels)}
+		gap, gapError, err := GapStatistic(rng, features, k, evidence[i].Inertia, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		evidence[i].Gap, evidence[i].GapError = gap, gapError
+	}
+	if k, err := SelectK(SelectGap, evidence); err != nil || k != 2 {
+		t.Errorf("gap selected k=%d with error %v, want 2", k, err)
+	}
+
+	// a zero inertia gives a finite gap
+	gap, _, err := GapStatistic(rng, [][]float64{{0}, {0}, {10}, {10}}, 2, 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.IsInf(gap, 0) || math.IsNaN(gap) {
+		t.Errorf("gap of a zero inertia is %f", gap)
+	}
+}